@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func callCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
+	var server string
+	var json bool
+	var flg config.Server
+
+	fs.StringVar(&server, "server", "", "name of server in configuration file")
+	fs.StringVar(&flg.URL, "url", "", "remote MCP server URL")
+	serverFlags(fs, &flg)
+	fs.BoolVar(&json, "json", false, "output as JSON")
+
+	args, _ := parse()
+	args, cmd := splitCommand(args)
+	if len(args) == 0 {
+		fatal("tool name is required")
+	}
+	rmt, lcl := resolveServer(fs, server, &flg, cmd)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var ret *mcp.CallToolResult
+	var err error
+	if lcl != nil {
+		ret, err = client.CallLocal(ctx, *lcl, args[0], args[1:])
+	} else {
+		ret, err = client.CallRemote(ctx, *rmt, args[0], args[1:])
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	if json {
+		printJSON(ret)
+	} else {
+		printToolResult(ret)
+	}
+
+	if ret.IsError {
+		fatal("tool returned an error")
+	}
+}
+
+func printJSON(v any) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fatal(err.Error())
+	}
+	fmt.Println(string(buf))
+}
+
+func printToolResult(ret *mcp.CallToolResult) {
+	for _, c := range ret.Content {
+		printContent("", c, -1)
+	}
+
+	if ret.StructuredContent != nil {
+		fmt.Println("---- Structured Content ----")
+		buf, err := json.MarshalIndent(ret.StructuredContent, "    ", "    ")
+		if err == nil {
+			fmt.Printf("    %s\n", string(buf))
+		}
+	}
+}
+
+func printContent(prefix string, c mcp.Content, n int) {
+	switch c := c.(type) {
+	case *mcp.TextContent:
+		printWithPrefix(prefix, c.Text, -1)
+	case *mcp.ImageContent:
+		fmt.Printf("%s[image %s, %d bytes]\n", prefix, c.MIMEType, len(c.Data))
+	case *mcp.AudioContent:
+		fmt.Printf("%s[audio %s, %d bytes]\n", prefix, c.MIMEType, len(c.Data))
+	case *mcp.ResourceLink:
+		fmt.Printf("%s[resource link %s", prefix, c.URI)
+		if c.MIMEType != "" {
+			fmt.Printf(" %s", c.MIMEType)
+		}
+		fmt.Println("]")
+		if c.Title != "" {
+			fmt.Printf("%s    %s\n", prefix, c.Title)
+		}
+		if c.Description != "" {
+			fmt.Printf("%s    %s\n", prefix, singleLine(c.Description, 70))
+		}
+	case *mcp.EmbeddedResource:
+		rc := c.Resource
+		if rc == nil {
+			fmt.Printf("%s[resource]\n", prefix)
+		} else if rc.Blob != nil {
+			fmt.Printf("%s[resource %s %s, %d bytes]\n", prefix, rc.URI, rc.MIMEType,
+				len(rc.Blob))
+		} else {
+			fmt.Printf("%s[resource %s %s]\n", prefix, rc.URI, rc.MIMEType)
+			printWithPrefix(prefix+"    ", rc.Text, n)
+		}
+	default:
+		fmt.Printf("%s[unknown content %T]\n", prefix, c)
+	}
+}
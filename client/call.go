@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	callImpl = mcp.Implementation{
+		Name:    "gmcpt-call-client",
+		Version: "0.1.0",
+	}
+)
+
+func CallLocal(ctx context.Context, lcl Local, name string,
+	toolArgs []string) (*mcp.CallToolResult, error) {
+
+	var ret *mcp.CallToolResult
+	err := withLocal(ctx, &callImpl, lcl,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = call(ctx, sess, name, toolArgs)
+			return err
+		})
+	return ret, err
+}
+
+func CallRemote(ctx context.Context, rmt Remote, name string, toolArgs []string) (
+	*mcp.CallToolResult, error) {
+
+	var ret *mcp.CallToolResult
+	err := withRemote(ctx, &callImpl, rmt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = call(ctx, sess, name, toolArgs)
+			return err
+		})
+	return ret, err
+}
+
+func call(ctx context.Context, sess *mcp.ClientSession, name string,
+	toolArgs []string) (*mcp.CallToolResult, error) {
+
+	if sess.InitializeResult().Capabilities.Tools == nil {
+		return nil, fmt.Errorf("server does not support tools")
+	}
+
+	var tool *mcp.Tool
+	for tl, err := range sess.Tools(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("listing tools: %s", err)
+		}
+		if tl.Name == name {
+			tool = tl
+			break
+		}
+	}
+	if tool == nil {
+		return nil, fmt.Errorf("tool not found: %s", name)
+	}
+
+	args, err := ToolArguments(tool, toolArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		return nil, fmt.Errorf("calling tool %s: %s", name, err)
+	}
+	return ret, nil
+}
+
+// ToolArguments converts key=value and key:=json strings into tool call arguments, using the
+// tool's input schema to coerce each value; repeating an array argument appends to it.
+func ToolArguments(tl *mcp.Tool, toolArgs []string) (map[string]any, error) {
+	schema, _ := tl.InputSchema.(map[string]any)
+	props, _ := schema["properties"].(map[string]any)
+
+	args := map[string]any{}
+	for _, ta := range toolArgs {
+		key, val, ok := strings.Cut(ta, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("argument must be key=value or key:=json: %s", ta)
+		}
+
+		if k, isJSON := strings.CutSuffix(key, ":"); isJSON {
+			var v any
+			err := json.Unmarshal([]byte(val), &v)
+			if err != nil {
+				return nil, fmt.Errorf("argument %s: invalid json: %s", k, err)
+			}
+			args[k] = v
+			continue
+		}
+
+		prop, ok := props[key].(map[string]any)
+		if !ok && props != nil {
+			if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+				return nil, fmt.Errorf("unknown argument: %s", key)
+			}
+		}
+
+		typ := schemaType(prop)
+		if typ == "array" {
+			items, _ := prop["items"].(map[string]any)
+			v, err := coerceArray(val, schemaType(items))
+			if err != nil {
+				return nil, fmt.Errorf("argument %s: %s", key, err)
+			}
+			if arr, ok := args[key].([]any); ok {
+				args[key] = append(arr, v...)
+			} else {
+				args[key] = v
+			}
+		} else {
+			v, err := coerceValue(val, typ)
+			if err != nil {
+				return nil, fmt.Errorf("argument %s: %s", key, err)
+			}
+			args[key] = v
+		}
+	}
+
+	if req, ok := schema["required"].([]any); ok {
+		for _, item := range req {
+			if name, ok := item.(string); ok {
+				if _, ok := args[name]; !ok {
+					return nil, fmt.Errorf("missing required argument: %s", name)
+				}
+			}
+		}
+	}
+
+	return args, nil
+}
+
+func schemaType(prop map[string]any) string {
+	switch typ := prop["type"].(type) {
+	case string:
+		return typ
+	case []any:
+		for _, t := range typ {
+			if s, ok := t.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func coerceArray(val, typ string) ([]any, error) {
+	if strings.HasPrefix(val, "[") {
+		var arr []any
+		err := json.Unmarshal([]byte(val), &arr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json array: %s", err)
+		}
+		return arr, nil
+	}
+
+	var arr []any
+	for s := range strings.SplitSeq(val, ",") {
+		v, err := coerceValue(s, typ)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func coerceValue(val, typ string) (any, error) {
+	switch typ {
+	case "string":
+		return val, nil
+	case "number":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected number: %s", val)
+		}
+		return f, nil
+	case "integer":
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected integer: %s", val)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("expected boolean: %s", val)
+		}
+		return b, nil
+	case "object", "array":
+		var v any
+		err := json.Unmarshal([]byte(val), &v)
+		if err != nil {
+			return nil, fmt.Errorf("expected json %s: %s", typ, err)
+		}
+		return v, nil
+	case "null":
+		if val != "null" {
+			return nil, fmt.Errorf("expected null: %s", val)
+		}
+		return nil, nil
+	}
+
+	// Untyped: accept a json literal, otherwise treat it as a string.
+	var v any
+	if json.Unmarshal([]byte(val), &v) == nil {
+		return v, nil
+	}
+	return val, nil
+}
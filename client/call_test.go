@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestToolArguments(t *testing.T) {
+	tl := &mcp.Tool{
+		Name: "test",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"s":   map[string]any{"type": "string"},
+				"n":   map[string]any{"type": "number"},
+				"i":   map[string]any{"type": "integer"},
+				"b":   map[string]any{"type": "boolean"},
+				"o":   map[string]any{"type": "object"},
+				"ns":  map[string]any{"type": []any{"null", "string"}},
+				"any": map[string]any{},
+				"arr": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"type": "integer"},
+				},
+			},
+			"required":             []any{"s"},
+			"additionalProperties": false,
+		},
+	}
+
+	cases := []struct {
+		args []string
+		want map[string]any
+		fail bool
+	}{
+		{args: []string{"s=hello"}, want: map[string]any{"s": "hello"}},
+		{args: []string{"s=a=b"}, want: map[string]any{"s": "a=b"}},
+		{args: []string{"s=123"}, want: map[string]any{"s": "123"}},
+		{args: []string{"s=", "n=1.5"}, want: map[string]any{"s": "", "n": 1.5}},
+		{args: []string{"s=x", "i=42"}, want: map[string]any{"s": "x", "i": int64(42)}},
+		{args: []string{"s=x", "b=true"}, want: map[string]any{"s": "x", "b": true}},
+		{args: []string{"s=x", "ns=abc"}, want: map[string]any{"s": "x", "ns": "abc"}},
+		{
+			args: []string{"s=x", `o={"k": 1}`},
+			want: map[string]any{"s": "x", "o": map[string]any{"k": 1.0}},
+		},
+		{args: []string{"s=x", "any=12"}, want: map[string]any{"s": "x", "any": 12.0}},
+		{args: []string{"s=x", "any=abc"}, want: map[string]any{"s": "x", "any": "abc"}},
+		{
+			args: []string{"s=x", "arr=1,2", "arr=3"},
+			want: map[string]any{"s": "x", "arr": []any{int64(1), int64(2), int64(3)}},
+		},
+		{
+			args: []string{"s=x", "arr=[4, 5]"},
+			want: map[string]any{"s": "x", "arr": []any{4.0, 5.0}},
+		},
+		{args: []string{"s:=123"}, want: map[string]any{"s": 123.0}},
+		{args: []string{`s:="abc"`}, want: map[string]any{"s": "abc"}},
+		{args: []string{"n=1"}, fail: true},
+		{args: []string{"s"}, fail: true},
+		{args: []string{"=s"}, fail: true},
+		{args: []string{"s=x", "n=abc"}, fail: true},
+		{args: []string{"s=x", "i=1.5"}, fail: true},
+		{args: []string{"s=x", "b=maybe"}, fail: true},
+		{args: []string{"s=x", "o=abc"}, fail: true},
+		{args: []string{"s=x", "arr=1,x"}, fail: true},
+		{args: []string{"s=x", "unknown=1"}, fail: true},
+		{args: []string{"s:=abc"}, fail: true},
+	}
+
+	for _, c := range cases {
+		got, err := ToolArguments(tl, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("ToolArguments(%v) did not fail", c.args)
+			}
+		} else if err != nil {
+			t.Errorf("ToolArguments(%v) failed with %s", c.args, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ToolArguments(%v) got %#v want %#v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestCallRemote(t *testing.T) {
+	tsvr := mcpsvr.NewMCPServer("test-call-server", "0.1.0",
+		mcpsvr.WithToolCapabilities(true))
+	tsvr.AddTool(mcpgo.NewTool("add",
+		mcpgo.WithDescription("adds two numbers"),
+		mcpgo.WithNumber("a", mcpgo.Required()),
+		mcpgo.WithNumber("b", mcpgo.Required())),
+		func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+			a := req.GetFloat("a", 0)
+			b := req.GetFloat("b", 0)
+			return mcpgo.NewToolResultText(fmt.Sprintf("sum: %g", a+b)), nil
+		})
+
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	cases := []struct {
+		name string
+		args []string
+		want string
+		fail bool
+	}{
+		{name: "add", args: []string{"a=1.5", "b=2"}, want: "sum: 3.5"},
+		{name: "add", args: []string{"a=1"}, fail: true},
+		{name: "add", args: []string{"a=one", "b=2"}, fail: true},
+		{name: "subtract", args: []string{"a=1", "b=2"}, fail: true},
+	}
+
+	url := svr.URL + "/mcp"
+	for _, c := range cases {
+		ret, err := CallRemote(context.Background(), Remote{URL: url}, c.name, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("CallRemote(%s, %v) did not fail", c.name, c.args)
+			}
+		} else if err != nil {
+			t.Errorf("CallRemote(%s, %v) failed with %s", c.name, c.args, err)
+		} else if len(ret.Content) != 1 {
+			t.Errorf("CallRemote(%s, %v) got %d content want 1", c.name, c.args,
+				len(ret.Content))
+		} else if tc, ok := ret.Content[0].(*mcp.TextContent); !ok {
+			t.Errorf("CallRemote(%s, %v) expected TextContent, got %T", c.name, c.args,
+				ret.Content[0])
+		} else if tc.Text != c.want {
+			t.Errorf("CallRemote(%s, %v) got %s want %s", c.name, c.args, tc.Text, c.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	completeImpl = mcp.Implementation{
+		Name:    "gmcpt-complete-client",
+		Version: "0.1.0",
+	}
+)
+
+func CompleteLocal(ctx context.Context, lcl Local, ref *mcp.CompleteReference,
+	compArgs []string) (*mcp.CompleteResult, error) {
+
+	var ret *mcp.CompleteResult
+	err := withLocal(ctx, &completeImpl, lcl,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = complete(ctx, sess, ref, compArgs)
+			return err
+		})
+	return ret, err
+}
+
+func CompleteRemote(ctx context.Context, rmt Remote, ref *mcp.CompleteReference,
+	compArgs []string) (*mcp.CompleteResult, error) {
+
+	var ret *mcp.CompleteResult
+	err := withRemote(ctx, &completeImpl, rmt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = complete(ctx, sess, ref, compArgs)
+			return err
+		})
+	return ret, err
+}
+
+func complete(ctx context.Context, sess *mcp.ClientSession, ref *mcp.CompleteReference,
+	compArgs []string) (*mcp.CompleteResult, error) {
+
+	if sess.InitializeResult().Capabilities.Completions == nil {
+		return nil, fmt.Errorf("server does not support completions")
+	}
+
+	params, err := CompleteParams(ref, compArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := sess.Complete(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("completing %s: %s", params.Argument.Name, err)
+	}
+	return ret, nil
+}
+
+// CompleteParams builds the parameters for a completion request. The first argument is the
+// argument to complete, either name or name=partial-value; the remaining arguments are key=value
+// strings for arguments which have already been filled in.
+func CompleteParams(ref *mcp.CompleteReference, compArgs []string) (*mcp.CompleteParams, error) {
+	if len(compArgs) == 0 {
+		return nil, fmt.Errorf("argument to complete is required")
+	}
+
+	name, value, _ := strings.Cut(compArgs[0], "=")
+	if name == "" {
+		return nil, fmt.Errorf("argument must be name or name=value: %s", compArgs[0])
+	}
+
+	params := &mcp.CompleteParams{
+		Argument: mcp.CompleteParamsArgument{Name: name, Value: value},
+		Ref:      ref,
+	}
+
+	if len(compArgs) > 1 {
+		args := map[string]string{}
+		for _, ca := range compArgs[1:] {
+			key, val, ok := strings.Cut(ca, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("argument must be key=value: %s", ca)
+			}
+			args[key] = val
+		}
+		params.Context = &mcp.CompleteContext{Arguments: args}
+	}
+
+	return params, nil
+}
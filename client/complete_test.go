@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCompleteParams(t *testing.T) {
+	ref := &mcp.CompleteReference{Type: "ref/prompt", Name: "greet"}
+
+	cases := []struct {
+		args []string
+		want *mcp.CompleteParams
+		fail bool
+	}{
+		{
+			args: []string{"name"},
+			want: &mcp.CompleteParams{
+				Argument: mcp.CompleteParamsArgument{Name: "name"},
+				Ref:      ref,
+			},
+		},
+		{
+			args: []string{"name=al"},
+			want: &mcp.CompleteParams{
+				Argument: mcp.CompleteParamsArgument{Name: "name", Value: "al"},
+				Ref:      ref,
+			},
+		},
+		{
+			args: []string{"name=al", "lang=en", "style=a=b"},
+			want: &mcp.CompleteParams{
+				Argument: mcp.CompleteParamsArgument{Name: "name", Value: "al"},
+				Context: &mcp.CompleteContext{
+					Arguments: map[string]string{"lang": "en", "style": "a=b"},
+				},
+				Ref: ref,
+			},
+		},
+		{args: []string{}, fail: true},
+		{args: []string{"=al"}, fail: true},
+		{args: []string{"name", "lang"}, fail: true},
+		{args: []string{"name", "=en"}, fail: true},
+	}
+
+	for _, c := range cases {
+		got, err := CompleteParams(ref, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("CompleteParams(%v) did not fail", c.args)
+			}
+		} else if err != nil {
+			t.Errorf("CompleteParams(%v) failed with %s", c.args, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("CompleteParams(%v) got %#v want %#v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestCompleteRemote(t *testing.T) {
+	colors := []string{"blue", "green", "grey", "red"}
+	tsvr := mcp.NewServer(&mcp.Implementation{Name: "test-complete-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			CompletionHandler: func(ctx context.Context, req *mcp.CompleteRequest) (
+				*mcp.CompleteResult, error) {
+
+				values := []string{}
+				for _, color := range colors {
+					if strings.HasPrefix(color, req.Params.Argument.Value) {
+						values = append(values, color)
+					}
+				}
+				return &mcp.CompleteResult{
+					Completion: mcp.CompletionResultDetails{Values: values},
+				}, nil
+			},
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return tsvr }, nil))
+	defer svr.Close()
+
+	cases := []struct {
+		ref  *mcp.CompleteReference
+		args []string
+		want []string
+		fail bool
+	}{
+		{
+			ref:  &mcp.CompleteReference{Type: "ref/prompt", Name: "paint"},
+			args: []string{"color=g"},
+			want: []string{"green", "grey"},
+		},
+		{
+			ref:  &mcp.CompleteReference{Type: "ref/resource", URI: "paint://{color}"},
+			args: []string{"color=r", "size=large"},
+			want: []string{"red"},
+		},
+		{
+			ref:  &mcp.CompleteReference{Type: "ref/prompt", Name: "paint"},
+			args: []string{"color=x"},
+			want: []string{},
+		},
+		{
+			ref:  &mcp.CompleteReference{Type: "ref/prompt", Name: "paint"},
+			args: []string{},
+			fail: true,
+		},
+	}
+
+	for _, c := range cases {
+		ret, err := CompleteRemote(context.Background(), Remote{URL: svr.URL}, c.ref, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("CompleteRemote(%v) did not fail", c.args)
+			}
+		} else if err != nil {
+			t.Errorf("CompleteRemote(%v) failed with %s", c.args, err)
+		} else if !slices.Equal(ret.Completion.Values, c.want) {
+			t.Errorf("CompleteRemote(%v) got %v want %v", c.args, ret.Completion.Values, c.want)
+		}
+	}
+}
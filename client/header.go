@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is a header to send to a remote server. Source is the value of the header, or where to
+// get the value from so that secrets need not be given on the command line:
+//
+//	env:NAME      the environment variable NAME
+//	file:PATH     the contents of the file PATH
+//	exec:COMMAND  the output of COMMAND, a credential helper
+//
+// A credential helper prints either the value or a JSON object with the value and when it
+// expires: {"value": "...", "expires_at": "2006-01-02T15:04:05Z"} or {"value": "...",
+// "expires_in": seconds}. Its output is cached until it expires, or for as long as the process
+// runs if it does not, unless the server responds with 401 Unauthorized. The value is sent with
+// Prefix, such as "Bearer ", in front of it.
+type Header struct {
+	Name   string
+	Prefix string
+	Source string
+}
+
+// ParseHeader parses a header of the form "Name: source".
+func ParseHeader(s string) (Header, error) {
+	name, source, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return Header{}, fmt.Errorf("header must be Name: value: %s", s)
+	}
+	return Header{Name: name, Source: strings.TrimSpace(source)}, nil
+}
+
+// BearerHeader returns an Authorization header for a bearer token from source.
+func BearerHeader(source string) Header {
+	return Header{Name: "Authorization", Prefix: "Bearer ", Source: source}
+}
+
+func (hdr Header) String() string {
+	return hdr.Name + ": " + hdr.Prefix + hdr.Source
+}
+
+type credential struct {
+	source string
+
+	mu     sync.Mutex
+	value  string
+	expiry time.Time
+	cached bool
+}
+
+func newCredential(source string) *credential {
+	return &credential{source: source}
+}
+
+func (cred *credential) get(ctx context.Context) (string, error) {
+	kind, arg, _ := strings.Cut(cred.source, ":")
+	switch kind {
+	case "env":
+		val, ok := os.LookupEnv(arg)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", arg)
+		}
+		return val, nil
+	case "file":
+		buf, err := os.ReadFile(arg)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(buf)), nil
+	case "exec":
+		return cred.exec(ctx, arg)
+	}
+	return cred.source, nil
+}
+
+// forget forgets the cached output of a credential helper if it is value, so that the helper is
+// run again; it returns false if the credential does not come from a helper.
+func (cred *credential) forget(value string) bool {
+	if !strings.HasPrefix(cred.source, "exec:") {
+		return false
+	}
+
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+
+	if cred.value == value {
+		cred.cached = false
+	}
+	return true
+}
+
+func (cred *credential) exec(ctx context.Context, command string) (string, error) {
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+
+	if cred.cached && (cred.expiry.IsZero() || time.Now().Before(cred.expiry)) {
+		return cred.value, nil
+	}
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("credential helper command is required")
+	}
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("credential helper %s: %s", args[0], err)
+	}
+
+	out = bytes.TrimSpace(out)
+	cred.value = string(out)
+	cred.expiry = time.Time{}
+	if len(out) > 0 && out[0] == '{' {
+		var ret struct {
+			Value     string    `json:"value"`
+			ExpiresAt time.Time `json:"expires_at"`
+			ExpiresIn int64     `json:"expires_in"`
+		}
+		err := json.Unmarshal(out, &ret)
+		if err != nil {
+			return "", fmt.Errorf("credential helper %s: %s", args[0], err)
+		}
+		cred.value = ret.Value
+		if !ret.ExpiresAt.IsZero() {
+			cred.expiry = ret.ExpiresAt
+		} else if ret.ExpiresIn > 0 {
+			cred.expiry = time.Now().Add(time.Duration(ret.ExpiresIn) * time.Second)
+		}
+	}
+	cred.cached = true
+	return cred.value, nil
+}
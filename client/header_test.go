@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseHeader(t *testing.T) {
+	cases := []struct {
+		s    string
+		hdr  Header
+		fail bool
+	}{
+		{s: "X-Api-Key: abc", hdr: Header{Name: "X-Api-Key", Source: "abc"}},
+		{s: "X-Api-Key:abc", hdr: Header{Name: "X-Api-Key", Source: "abc"}},
+		{s: "Authorization: Bearer env:TOKEN",
+			hdr: Header{Name: "Authorization", Source: "Bearer env:TOKEN"}},
+		{s: "X-Token: exec:helper --get token",
+			hdr: Header{Name: "X-Token", Source: "exec:helper --get token"}},
+		{s: "X-Empty:", hdr: Header{Name: "X-Empty"}},
+		{s: "X-Api-Key", fail: true},
+		{s: ": abc", fail: true},
+		{s: "X Api Key: abc", fail: true},
+	}
+
+	for _, c := range cases {
+		hdr, err := ParseHeader(c.s)
+		if c.fail {
+			if err == nil {
+				t.Errorf("ParseHeader(%q) did not fail", c.s)
+			}
+		} else if err != nil {
+			t.Errorf("ParseHeader(%q) failed with %s", c.s, err)
+		} else if hdr != c.hdr {
+			t.Errorf("ParseHeader(%q) got %v want %v", c.s, hdr, c.hdr)
+		}
+	}
+}
+
+func TestCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper test requires sh")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	err := os.WriteFile(file, []byte("file-secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := filepath.Join(dir, "count")
+	helper := filepath.Join(dir, "helper")
+	err = os.WriteFile(helper, []byte(`#!/bin/sh
+echo x >> `+count+`
+if [ "$1" = "json" ]; then
+	echo '{"value": "json-secret", "expires_in": 3600}'
+elif [ "$1" = "expired" ]; then
+	echo '{"value": "expired-secret", "expires_at": "2000-01-01T00:00:00Z"}'
+else
+	echo plain-secret
+fi
+`), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GMCPT_TEST_TOKEN", "env-secret")
+
+	cases := []struct {
+		source string
+		value  string
+		runs   int
+		fail   bool
+	}{
+		{source: "literal", value: "literal"},
+		{source: "env:GMCPT_TEST_TOKEN", value: "env-secret"},
+		{source: "env:GMCPT_TEST_MISSING", fail: true},
+		{source: "file:" + file, value: "file-secret"},
+		{source: "file:" + filepath.Join(dir, "missing"), fail: true},
+		{source: "exec:" + helper, value: "plain-secret", runs: 1},
+		{source: "exec:" + helper + " json", value: "json-secret", runs: 1},
+		{source: "exec:" + helper + " expired", value: "expired-secret", runs: 3},
+		{source: "exec:" + filepath.Join(dir, "missing"), fail: true},
+	}
+
+	for _, c := range cases {
+		os.Remove(count)
+
+		cred := newCredential(c.source)
+		for range 3 {
+			val, err := cred.get(context.Background())
+			if c.fail {
+				if err == nil {
+					t.Errorf("get(%s) did not fail", c.source)
+				}
+			} else if err != nil {
+				t.Errorf("get(%s) failed with %s", c.source, err)
+			} else if val != c.value {
+				t.Errorf("get(%s) got %s want %s", c.source, val, c.value)
+			}
+		}
+
+		buf, _ := os.ReadFile(count)
+		if runs := len(buf) / 2; runs != c.runs {
+			t.Errorf("get(%s) ran helper %d times want %d", c.source, runs, c.runs)
+		}
+	}
+}
+
+func TestRemoteHeaders(t *testing.T) {
+	handler := mcpsvr.NewStreamableHTTPServer(mcpsvr.NewMCPServer("test-server", "0.1.0"))
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer env-secret" ||
+			r.Header.Get("X-Tenant") != "test" {
+
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer svr.Close()
+
+	t.Setenv("GMCPT_TEST_TOKEN", "env-secret")
+	tenant := Header{Name: "X-Tenant", Source: "test"}
+
+	cases := []struct {
+		rmt  Remote
+		fail bool
+	}{
+		{rmt: Remote{Headers: []Header{BearerHeader("env:GMCPT_TEST_TOKEN"), tenant}}},
+		{rmt: Remote{APIKey: "env:GMCPT_TEST_TOKEN", Headers: []Header{tenant}}},
+		{rmt: Remote{APIKey: "env:GMCPT_TEST_TOKEN", Header: "X-Api-Key",
+			Headers: []Header{tenant}}, fail: true},
+		{rmt: Remote{Headers: []Header{BearerHeader("env:GMCPT_TEST_TOKEN")}}, fail: true},
+	}
+
+	for _, c := range cases {
+		c.rmt.URL = svr.URL + "/mcp"
+		_, err := ListRemote(context.Background(), c.rmt, ListTools)
+		if c.fail {
+			if err == nil {
+				t.Errorf("ListRemote(%v) did not fail", c.rmt.Headers)
+			}
+		} else if err != nil {
+			t.Errorf("ListRemote(%v) failed with %s", c.rmt.Headers, err)
+		}
+	}
+}
+
+func TestRotatedCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper test requires cat")
+	}
+
+	var token atomic.Value
+	token.Store("old-secret")
+	handler := mcpsvr.NewStreamableHTTPServer(mcpsvr.NewMCPServer("test-server", "0.1.0"))
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token.Load().(string) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer svr.Close()
+
+	file := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(file, []byte("old-secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewSessionManager(Remote{
+		URL:     svr.URL + "/mcp",
+		Headers: []Header{BearerHeader("exec:cat " + file)},
+	})
+	defer sm.Close()
+
+	clnt := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil)
+	ping := func(ctx context.Context, sess *mcp.ClientSession) error {
+		return sess.Ping(ctx, nil)
+	}
+	err = sm.WithSession(context.Background(), clnt, ping)
+	if err != nil {
+		t.Fatalf("WithSession() failed with %s", err)
+	}
+
+	// The server rejects the cached output of the helper once the token is rotated.
+	token.Store("new-secret")
+	err = os.WriteFile(file, []byte("new-secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = sm.WithSession(ctx, clnt, ping)
+	if err != nil {
+		t.Errorf("WithSession() after rotating the token failed with %s", err)
+	}
+}
@@ -3,7 +3,6 @@ package client
 import (
 	"context"
 	"fmt"
-	"os/exec"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -14,12 +13,15 @@ const (
 	ListPrompts ListOptions = 1 << iota
 	ListResources
 	ListTools
+	ListResourceTemplates
 )
 
 type ListOutput struct {
-	Prompts   []*mcp.Prompt   `json:"prompts,omitempty"`
-	Resources []*mcp.Resource `json:"resources,omitempty"`
-	Tools     []*mcp.Tool     `json:"tools,omitempty"`
+	Transport         string                  `json:"transport,omitempty"`
+	Prompts           []*mcp.Prompt           `json:"prompts,omitempty"`
+	Resources         []*mcp.Resource         `json:"resources,omitempty"`
+	ResourceTemplates []*mcp.ResourceTemplate `json:"resourceTemplates,omitempty"`
+	Tools             []*mcp.Tool             `json:"tools,omitempty"`
 }
 
 var (
@@ -29,34 +31,38 @@ var (
 	}
 )
 
-func ListLocal(ctx context.Context, cmd string, args []string, lstOpts ListOptions) (*ListOutput,
+func ListLocal(ctx context.Context, lcl Local, lstOpts ListOptions) (*ListOutput,
 	error) {
 
-	sess, err := mcp.NewClient(&listImpl, nil).Connect(ctx,
-		&mcp.CommandTransport{
-			Command: exec.Command(cmd, args...),
-		}, nil)
-	if err != nil {
-		return nil, fmt.Errorf("connecting to command: %s", err)
-	}
-	defer sess.Close()
-
-	return list(ctx, sess, lstOpts)
+	var lst *ListOutput
+	err := withLocal(ctx, &listImpl, lcl,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			lst, err = list(ctx, sess, lstOpts)
+			if err != nil {
+				return err
+			}
+			lst.Transport = StdioTransport
+			return nil
+		})
+	return lst, err
 }
 
-func ListRemote(ctx context.Context, url, apiKey, header string, sse bool,
-	lstOpts ListOptions) (*ListOutput, error) {
+func ListRemote(ctx context.Context, rmt Remote, lstOpts ListOptions) (*ListOutput, error) {
 
-	sm := NewSessionManager(url, apiKey, header, sse)
+	sm := NewSessionManager(rmt)
 	defer sm.Close()
 
 	var lst *ListOutput
-	err := sm.WithSession(ctx,
-		mcp.NewClient(&listImpl, nil),
+	err := sm.WithSession(ctx, mcp.NewClient(&listImpl, nil),
 		func(ctx context.Context, sess *mcp.ClientSession) error {
 			var err error
 			lst, err = list(ctx, sess, lstOpts)
-			return err
+			if err != nil {
+				return err
+			}
+			lst.Transport = sm.Transport()
+			return nil
 		})
 	return lst, err
 }
@@ -81,6 +87,14 @@ func list(ctx context.Context, sess *mcp.ClientSession, lstOpts ListOptions) (*L
 		lst.Resources = ret.Resources
 	}
 
+	if lstOpts&ListResourceTemplates != 0 && ir.Capabilities.Resources != nil {
+		ret, err := sess.ListResourceTemplates(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing resource templates: %s", err)
+		}
+		lst.ResourceTemplates = ret.ResourceTemplates
+	}
+
 	if lstOpts&ListTools != 0 && ir.Capabilities.Tools != nil {
 		ret, err := sess.ListTools(ctx, nil)
 		if err != nil {
@@ -51,6 +51,17 @@ func newAllCapsServer() *mcpsvr.MCPServer {
 			}, nil
 		})
 
+	tsvr.AddResourceTemplate(
+		mcpgo.NewResourceTemplate("file:///docs/{name}", "docs",
+			mcpgo.WithTemplateDescription("test documents")),
+		func(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents,
+			error) {
+
+			return []mcpgo.ResourceContents{
+				mcpgo.TextResourceContents{URI: req.Params.URI, Text: "doc"},
+			}, nil
+		})
+
 	return tsvr
 }
 
@@ -60,11 +71,15 @@ func TestListAll(t *testing.T) {
 	defer svr.Close()
 
 	url := svr.URL + "/mcp"
-	lst, err := ListRemote(context.Background(), url, "", "", false,
+	lst, err := ListRemote(context.Background(), Remote{URL: url},
 		ListTools|ListPrompts|ListResources)
 	if err != nil {
 		t.Errorf("ListRemote(%s) failed with %s", url, err)
 	} else {
+		if lst.Transport != StreamableTransport {
+			t.Errorf("ListRemote(%s) got transport %s want %s", url, lst.Transport,
+				StreamableTransport)
+		}
 		if len(lst.Tools) != 2 {
 			t.Errorf("ListRemote(%s) got %d tools want 2", url, len(lst.Tools))
 		}
@@ -102,6 +117,7 @@ func TestListSelectiveOptions(t *testing.T) {
 		tools     int
 		prompts   int
 		resources int
+		templates int
 	}{
 		{opts: ListTools, tools: 2},
 		{opts: ListPrompts, prompts: 1},
@@ -109,6 +125,8 @@ func TestListSelectiveOptions(t *testing.T) {
 		{opts: ListTools | ListPrompts, tools: 2, prompts: 1},
 		{opts: ListTools | ListResources, tools: 2, resources: 1},
 		{opts: ListPrompts | ListResources, prompts: 1, resources: 1},
+		{opts: ListResourceTemplates, templates: 1},
+		{opts: ListResources | ListResourceTemplates, resources: 1, templates: 1},
 	}
 
 	tsvr := newAllCapsServer()
@@ -118,7 +136,7 @@ func TestListSelectiveOptions(t *testing.T) {
 	ctx := context.Background()
 	for _, c := range cases {
 		url := svr.URL + "/mcp"
-		lst, err := ListRemote(ctx, url, "", "", false, c.opts)
+		lst, err := ListRemote(ctx, Remote{URL: url}, c.opts)
 		if err != nil {
 			t.Errorf("ListRemote(%s, %v) failed with %s", url, c.opts, err)
 			continue
@@ -136,6 +154,10 @@ func TestListSelectiveOptions(t *testing.T) {
 			t.Errorf("ListRemote(%s, %v) got %d resources want %d", url, c.opts,
 				len(lst.Resources), c.resources)
 		}
+		if len(lst.ResourceTemplates) != c.templates {
+			t.Errorf("ListRemote(%s, %v) got %d resource templates want %d", url, c.opts,
+				len(lst.ResourceTemplates), c.templates)
+		}
 	}
 }
 
@@ -169,7 +191,7 @@ func TestListRemoteServers(t *testing.T) {
 	cases := []struct {
 		short     bool
 		url       string
-		sse       bool
+		transport string
 		prompts   []string
 		resources []string
 		tools     []string
@@ -180,11 +202,11 @@ func TestListRemoteServers(t *testing.T) {
 				"aws___read_documentation", "aws___recommend", "aws___search_documentation"},
 		},
 		{
-			short:   true,
-			url:     "https://docs.mcp.cloudflare.com/sse",
-			sse:     true,
-			prompts: []string{"workers-prompt-full"},
-			tools:   []string{"migrate_pages_to_workers_guide", "search_cloudflare_documentation"},
+			short:     true,
+			url:       "https://docs.mcp.cloudflare.com/sse",
+			transport: SSETransport,
+			prompts:   []string{"workers-prompt-full"},
+			tools:     []string{"migrate_pages_to_workers_guide", "search_cloudflare_documentation"},
 		},
 		{
 			short:     true,
@@ -225,7 +247,7 @@ func TestListRemoteServers(t *testing.T) {
 			continue
 		}
 
-		lst, err := ListRemote(context.Background(), c.url, "", "", c.sse,
+		lst, err := ListRemote(context.Background(), Remote{URL: c.url, Transport: c.transport},
 			ListTools|ListPrompts|ListResources)
 		if err != nil {
 			t.Errorf("ListRemote(%s) failed: %s", c.url, err)
@@ -253,7 +275,7 @@ func TestListCapabilitiesFilter(t *testing.T) {
 	defer svr.Close()
 
 	url := svr.URL + "/mcp"
-	lst, err := ListRemote(context.Background(), url, "", "", false,
+	lst, err := ListRemote(context.Background(), Remote{URL: url},
 		ListTools|ListPrompts|ListResources)
 	if err != nil {
 		t.Errorf("ListRemote(%s) failed with %s", url, err)
@@ -0,0 +1,793 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// oauthCacheFile returns the path of the file used to cache client registrations and tokens
+	// between runs.
+	oauthCacheFile = func() (string, error) {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "gmcpt", "oauth.json"), nil
+	}
+
+	// openBrowser asks the user to authorize access by visiting authURL.
+	openBrowser = func(authURL string) error {
+		fmt.Fprintf(os.Stderr, "open the following URL in a browser to authorize access:\n    %s\n",
+			authURL)
+
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", authURL)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", authURL)
+		default:
+			cmd = exec.Command("xdg-open", authURL)
+		}
+		return cmd.Start()
+	}
+
+	oauthCacheMu sync.Mutex
+)
+
+type oauthCache struct {
+	Clients map[string]*oauthClient `json:"clients,omitempty"` // by authorization server
+	Tokens  map[string]*oauthToken  `json:"tokens,omitempty"`  // by MCP server URL
+}
+
+type oauthClient struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	RedirectURI  string `json:"redirect_uri"`
+}
+
+type oauthToken struct {
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	Expiry        time.Time `json:"expiry,omitzero"`
+	Issuer        string    `json:"issuer"`
+	TokenEndpoint string    `json:"token_endpoint"`
+	Resource      string    `json:"resource"`
+}
+
+func (tok *oauthToken) expired() bool {
+	return !tok.Expiry.IsZero() && time.Now().Add(30*time.Second).After(tok.Expiry)
+}
+
+func loadOAuthCache() (*oauthCache, error) {
+	cache := &oauthCache{
+		Clients: map[string]*oauthClient{},
+		Tokens:  map[string]*oauthToken{},
+	}
+
+	path, err := oauthCacheFile()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buf, cache)
+	if err != nil {
+		return nil, fmt.Errorf("oauth cache %s: %s", path, err)
+	}
+	return cache, nil
+}
+
+// updateOAuthCache loads the cache, calls update, and then atomically replaces the cache file,
+// which is only readable by the user.
+func updateOAuthCache(update func(cache *oauthCache)) error {
+	oauthCacheMu.Lock()
+	defer oauthCacheMu.Unlock()
+
+	cache, err := loadOAuthCache()
+	if err != nil {
+		return err
+	}
+	update(cache)
+
+	path, err := oauthCacheFile()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600.
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// forgetClient removes clnt, which the authorization server no longer accepts, from the cache, so
+// that a new client is registered.
+func forgetClient(issuer string, clnt *oauthClient) {
+	err := updateOAuthCache(func(cache *oauthCache) {
+		if c, ok := cache.Clients[issuer]; ok && c.ClientID == clnt.ClientID {
+			delete(cache.Clients, issuer)
+		}
+	})
+	if err != nil {
+		slog.Warn("oauth cache", "error", err)
+	}
+}
+
+// oauthTransport authorizes requests to a remote server using OAuth 2.1. Tokens are only
+// requested once the server responds with 401 Unauthorized; after that, they are refreshed as
+// needed and cached on disk so that they can be reused by later runs. Requests to the server are
+// sent using server, which must not replace the Authorization header; requests to discover and
+// use the authorization server are sent using base, which must not add credentials of its own.
+type oauthTransport struct {
+	base      http.RoundTripper
+	server    http.RoundTripper
+	serverURL string
+
+	mu      sync.Mutex
+	loaded  bool
+	token   *oauthToken
+	pending *pendingToken
+}
+
+// pendingToken is a new token being obtained by one request, which other requests needing a new
+// token wait for.
+type pendingToken struct {
+	done        chan struct{}
+	refreshOnly bool
+	tok         *oauthToken
+	err         error
+}
+
+func newOAuthTransport(base, server http.RoundTripper, serverURL string) *oauthTransport {
+	return &oauthTransport{
+		base:      base,
+		server:    server,
+		serverURL: serverURL,
+	}
+}
+
+func (ot *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok := ot.currentToken(req.Context())
+	resp, err := ot.server.RoundTrip(ot.authorize(req, tok))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Values("WWW-Authenticate")
+	if !slices.ContainsFunc(challenge, isBearer) || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	tok, err = ot.newToken(req.Context(), tok, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: %s", err)
+	}
+
+	req = req.Clone(req.Context())
+	if req.Body != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ot.server.RoundTrip(ot.authorize(req, tok))
+}
+
+func isBearer(challenge string) bool {
+	return len(challenge) >= 6 && strings.EqualFold(challenge[:6], "bearer")
+}
+
+func (ot *oauthTransport) authorize(req *http.Request, tok *oauthToken) *http.Request {
+	if tok == nil {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return req
+}
+
+// currentToken returns the token to use, loading it from the cache and refreshing it if it has
+// expired.
+func (ot *oauthTransport) currentToken(ctx context.Context) *oauthToken {
+	ot.mu.Lock()
+	if !ot.loaded {
+		ot.loaded = true
+		oauthCacheMu.Lock()
+		cache, err := loadOAuthCache()
+		oauthCacheMu.Unlock()
+		if err != nil {
+			slog.Warn("oauth cache", "error", err)
+		} else {
+			ot.token = cache.Tokens[ot.serverURL]
+		}
+	}
+	tok := ot.token
+	ot.mu.Unlock()
+
+	if tok != nil && tok.expired() && tok.RefreshToken != "" {
+		newTok, err := ot.newToken(ctx, tok, nil)
+		if err != nil {
+			slog.Warn("oauth refresh", "url", ot.serverURL, "error", err)
+		} else {
+			tok = newTok
+		}
+	}
+	return tok
+}
+
+// newToken replaces old, which expired or was rejected by the server, by refreshing it or, if
+// there is a challenge from the server, by authorizing access again. Only one request at a time
+// obtains a new token, without holding the lock; other requests wait for it, so requests which
+// do not need a new token are not delayed while the user authorizes access.
+func (ot *oauthTransport) newToken(ctx context.Context, old *oauthToken,
+	challenge []string) (*oauthToken, error) {
+
+	for {
+		ot.mu.Lock()
+		if ot.token != old {
+			// Another request already replaced the token.
+			tok := ot.token
+			ot.mu.Unlock()
+			return tok, nil
+		}
+
+		p := ot.pending
+		if p == nil {
+			break
+		}
+		ot.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.done:
+		}
+		if p.err == nil || !p.refreshOnly || challenge == nil {
+			return p.tok, p.err
+		}
+	}
+
+	p := &pendingToken{done: make(chan struct{}), refreshOnly: challenge == nil}
+	ot.pending = p
+	ot.mu.Unlock()
+
+	p.tok, p.err = ot.fetchToken(ctx, old, challenge)
+
+	ot.mu.Lock()
+	ot.pending = nil
+	if p.err == nil {
+		ot.token = p.tok
+	}
+	ot.mu.Unlock()
+	close(p.done)
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	err := updateOAuthCache(func(cache *oauthCache) {
+		cache.Tokens[ot.serverURL] = p.tok
+	})
+	if err != nil {
+		slog.Warn("oauth cache", "error", err)
+	}
+	return p.tok, nil
+}
+
+func (ot *oauthTransport) fetchToken(ctx context.Context, old *oauthToken,
+	challenge []string) (*oauthToken, error) {
+
+	if old != nil && old.RefreshToken != "" {
+		tok, err := ot.refresh(ctx, old)
+		if err == nil {
+			return tok, nil
+		} else if challenge == nil {
+			return nil, err
+		}
+		slog.Warn("oauth refresh", "url", ot.serverURL, "error", err)
+	}
+	if challenge == nil {
+		return nil, fmt.Errorf("no refresh token")
+	}
+	return ot.authorizationCode(ctx, challenge)
+}
+
+type protectedResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported"`
+}
+
+type authServerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	RegistrationEndpoint  string   `json:"registration_endpoint"`
+	ScopesSupported       []string `json:"scopes_supported"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+var challengeParam = regexp.MustCompile(`(resource_metadata|scope)="([^"]*)"`)
+
+// authorizationCode discovers the authorization server for the MCP server, registers a client
+// if necessary, and runs the authorization code flow with PKCE, using a loopback redirect.
+func (ot *oauthTransport) authorizationCode(ctx context.Context,
+	challenge []string) (*oauthToken, error) {
+
+	var prmURL, scope string
+	for _, c := range challenge {
+		if !isBearer(c) {
+			continue
+		}
+		for _, m := range challengeParam.FindAllStringSubmatch(c, -1) {
+			if m[1] == "resource_metadata" {
+				prmURL = m[2]
+			} else {
+				scope = m[2]
+			}
+		}
+	}
+
+	su, err := url.Parse(ot.serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var prm protectedResourceMetadata
+	urls := wellKnownURLs(su, "oauth-protected-resource")
+	if prmURL != "" {
+		urls = []string{prmURL}
+	}
+	err = ot.getMetadata(ctx, urls, &prm)
+	if err == nil && prm.Resource != "" && !isResourceFor(prm.Resource, su) {
+		return nil, fmt.Errorf("protected resource metadata is for %s, not %s", prm.Resource,
+			ot.serverURL)
+	}
+	if err != nil || len(prm.AuthorizationServers) == 0 {
+		// Fall back to the MCP server's origin being the authorization server.
+		prm.AuthorizationServers = []string{su.Scheme + "://" + su.Host}
+	}
+	if prm.Resource == "" {
+		prm.Resource = ot.serverURL
+	}
+	if scope == "" {
+		scope = strings.Join(prm.ScopesSupported, " ")
+	}
+
+	issuer := prm.AuthorizationServers[0]
+	iu, err := url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+	var asm authServerMetadata
+	urls = append(wellKnownURLs(iu, "oauth-authorization-server"),
+		wellKnownURLs(iu, "openid-configuration")...)
+	if strings.Trim(iu.Path, "/") != "" {
+		urls = append(urls, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	}
+	err = ot.getMetadata(ctx, urls, &asm)
+	if err != nil {
+		return nil, fmt.Errorf("authorization server metadata for %s: %s", issuer, err)
+	}
+	if asm.Issuer != issuer {
+		// RFC 8414, section 3.3: the issuer must be the one the metadata was requested for.
+		return nil, fmt.Errorf("authorization server metadata is for %s, not %s", asm.Issuer,
+			issuer)
+	}
+	if !slices.Contains(asm.CodeChallengeMethods, "S256") {
+		// PKCE support must be advertised; it can not be assumed.
+		return nil, fmt.Errorf("authorization server %s does not support PKCE with S256", issuer)
+	}
+
+	tok, clnt, err := ot.authorizeClient(ctx, issuer, &asm, prm.Resource, scope)
+	if isInvalidClient(err) {
+		// The client is no longer registered with the authorization server.
+		slog.Warn("oauth client rejected", "issuer", issuer, "error", err)
+		forgetClient(issuer, clnt)
+		tok, _, err = ot.authorizeClient(ctx, issuer, &asm, prm.Resource, scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok.Issuer = issuer
+	tok.TokenEndpoint = asm.TokenEndpoint
+	tok.Resource = prm.Resource
+
+	slog.Info("oauth authorized", "url", ot.serverURL, "issuer", issuer)
+	return tok, nil
+}
+
+// authorizeClient runs the authorization code flow with the client registered with the
+// authorization server, registering one if necessary, and returns the token and the client.
+func (ot *oauthTransport) authorizeClient(ctx context.Context, issuer string,
+	asm *authServerMetadata, resource, scope string) (*oauthToken, *oauthClient, error) {
+
+	oauthCacheMu.Lock()
+	cache, err := loadOAuthCache()
+	oauthCacheMu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	clnt := cache.Clients[issuer]
+
+	var ln net.Listener
+	if clnt != nil {
+		ru, err := url.Parse(clnt.RedirectURI)
+		if err == nil {
+			ln, err = net.Listen("tcp", ru.Host)
+		}
+		if err != nil {
+			// The port is no longer available, so register a new client.
+			clnt = nil
+		}
+	}
+	if ln == nil {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	defer ln.Close()
+
+	if clnt == nil {
+		redirectURI := "http://" + ln.Addr().String() + "/callback"
+		clnt, err = ot.register(ctx, asm, redirectURI)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = updateOAuthCache(func(cache *oauthCache) {
+			cache.Clients[issuer] = clnt
+		})
+		if err != nil {
+			slog.Warn("oauth cache", "error", err)
+		}
+	}
+
+	verifier := randomString()
+	sum := sha256.Sum256([]byte(verifier))
+	state := randomString()
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clnt.ClientID},
+		"redirect_uri":          {clnt.RedirectURI},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		"resource":              {resource},
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+	authURL := asm.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+
+	code, err := waitForCode(ctx, ln, state, authURL)
+	if err != nil {
+		return nil, clnt, err
+	}
+
+	tok, err := ot.tokenRequest(ctx, asm.TokenEndpoint, clnt, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {clnt.RedirectURI},
+		"code_verifier": {verifier},
+		"resource":      {resource},
+	})
+	return tok, clnt, err
+}
+
+// isResourceFor returns true if resource, from protected resource metadata, identifies the server
+// at su: it has the same origin and its path is the path of su or a prefix of it.
+func isResourceFor(resource string, su *url.URL) bool {
+	ru, err := url.Parse(resource)
+	if err != nil || !strings.EqualFold(ru.Scheme, su.Scheme) ||
+		!strings.EqualFold(ru.Host, su.Host) {
+
+		return false
+	}
+
+	rp := strings.TrimSuffix(ru.Path, "/")
+	sp := strings.TrimSuffix(su.Path, "/")
+	return sp == rp || strings.HasPrefix(sp, rp+"/")
+}
+
+// wellKnownURLs returns the well-known URLs for name for u, first with the path of u inserted
+// after the well-known prefix, then without it.
+func wellKnownURLs(u *url.URL, name string) []string {
+	base := u.Scheme + "://" + u.Host + "/.well-known/" + name
+	if p := strings.TrimRight(u.Path, "/"); p != "" {
+		return []string{base + p, base}
+	}
+	return []string{base}
+}
+
+func (ot *oauthTransport) getMetadata(ctx context.Context, urls []string, v any) error {
+	var err error
+	for _, u := range urls {
+		err = ot.getJSON(ctx, u, v)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (ot *oauthTransport) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := ot.base.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// register uses dynamic client registration to register gmcpt as a public client.
+func (ot *oauthTransport) register(ctx context.Context, asm *authServerMetadata,
+	redirectURI string) (*oauthClient, error) {
+
+	if asm.RegistrationEndpoint == "" {
+		return nil, fmt.Errorf("authorization server %s does not support client registration",
+			asm.Issuer)
+	}
+
+	buf, err := json.Marshal(map[string]any{
+		"client_name":                "gmcpt",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, asm.RegistrationEndpoint,
+		bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ot.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("registering client: %s: %s", resp.Status, body)
+	}
+
+	clnt := oauthClient{RedirectURI: redirectURI}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&clnt)
+	if err != nil {
+		return nil, fmt.Errorf("registering client: %s", err)
+	} else if clnt.ClientID == "" {
+		return nil, fmt.Errorf("registering client: missing client_id")
+	}
+	clnt.RedirectURI = redirectURI
+	return &clnt, nil
+}
+
+// waitForCode asks the user to visit authURL and then waits for the authorization server to
+// redirect back to the loopback listener with the authorization code.
+func waitForCode(ctx context.Context, ln net.Listener, state, authURL string) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	ch := make(chan result, 1)
+
+	svr := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/callback" {
+				http.NotFound(w, r)
+				return
+			}
+
+			q := r.URL.Query()
+			var res result
+			if q.Get("state") != state {
+				res.err = fmt.Errorf("authorization state mismatch")
+			} else if e := q.Get("error"); e != "" {
+				res.err = fmt.Errorf("authorization failed: %s %s", e, q.Get("error_description"))
+			} else if res.code = q.Get("code"); res.code == "" {
+				res.err = fmt.Errorf("authorization missing code")
+			}
+
+			if res.err != nil {
+				http.Error(w, res.err.Error(), http.StatusBadRequest)
+			} else {
+				fmt.Fprintln(w, "gmcpt is authorized; this window may be closed.")
+			}
+			select {
+			case ch <- res:
+			default:
+			}
+		}),
+	}
+	go svr.Serve(ln)
+	defer svr.Close()
+
+	err := openBrowser(authURL)
+	if err != nil {
+		slog.Warn("open browser", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	select {
+	case res := <-ch:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for authorization: %s", ctx.Err())
+	}
+}
+
+func (ot *oauthTransport) refresh(ctx context.Context, old *oauthToken) (*oauthToken, error) {
+	oauthCacheMu.Lock()
+	cache, err := loadOAuthCache()
+	oauthCacheMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	clnt := cache.Clients[old.Issuer]
+	if clnt == nil {
+		return nil, fmt.Errorf("no client registered with %s", old.Issuer)
+	}
+
+	tok, err := ot.tokenRequest(ctx, old.TokenEndpoint, clnt, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {old.RefreshToken},
+		"resource":      {old.Resource},
+	})
+	if isInvalidClient(err) {
+		// A new client is registered when access is authorized again.
+		forgetClient(old.Issuer, clnt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = old.RefreshToken
+	}
+	tok.Issuer = old.Issuer
+	tok.TokenEndpoint = old.TokenEndpoint
+	tok.Resource = old.Resource
+
+	slog.Info("oauth refreshed", "url", ot.serverURL)
+	return tok, nil
+}
+
+func (ot *oauthTransport) tokenRequest(ctx context.Context, endpoint string, clnt *oauthClient,
+	params url.Values) (*oauthToken, error) {
+
+	params.Set("client_id", clnt.ClientID)
+	if clnt.ClientSecret != "" {
+		params.Set("client_secret", clnt.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint,
+		strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := ot.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ret struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ret)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %s: %s", resp.Status, err)
+	} else if ret.Error != "" {
+		return nil, &tokenError{code: ret.Error, description: ret.ErrorDescription}
+	} else if resp.StatusCode != http.StatusOK || ret.AccessToken == "" {
+		return nil, fmt.Errorf("token request: %s", resp.Status)
+	}
+
+	tok := &oauthToken{
+		AccessToken:  ret.AccessToken,
+		RefreshToken: ret.RefreshToken,
+	}
+	if ret.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(ret.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// tokenError is an error response from a token endpoint.
+type tokenError struct {
+	code        string
+	description string
+}
+
+func (te *tokenError) Error() string {
+	return fmt.Sprintf("token request: %s %s", te.code, te.description)
+}
+
+func isInvalidClient(err error) bool {
+	var te *tokenError
+	return errors.As(err, &te) && te.code == "invalid_client"
+}
+
+func randomString() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,352 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+)
+
+type testAuthServer struct {
+	mu          sync.Mutex
+	registered  int
+	authorized  int
+	refreshed   int
+	challenges  map[string]string // code -> code challenge
+	tokens      map[string]bool   // valid access tokens
+	nextToken   int
+	redirectURI string
+	clientID    string // the registered client
+	leaked      int    // requests, other than to the server, with credentials
+
+	resource string // resource in the protected resource metadata, if not the server
+	issuer   string // issuer in the authorization server metadata, if not the server
+	noPKCE   bool   // do not advertise support for PKCE
+}
+
+func (tas *testAuthServer) newToken() string {
+	tas.nextToken += 1
+	tok := fmt.Sprintf("access-%d", tas.nextToken)
+	tas.tokens[tok] = true
+	return tok
+}
+
+func (tas *testAuthServer) revokeTokens() {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+
+	clear(tas.tokens)
+}
+
+func (tas *testAuthServer) revokeClient() {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+
+	tas.clientID = ""
+}
+
+func (tas *testAuthServer) resourceURL(svrURL string) string {
+	if tas.resource != "" {
+		return tas.resource
+	}
+	return svrURL + "/mcp"
+}
+
+func (tas *testAuthServer) handler(svrURL *string, mcpHandler http.Handler) http.Handler {
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp",
+		func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]any{
+				"resource":              tas.resourceURL(*svrURL),
+				"authorization_servers": []string{*svrURL + "/auth"},
+			})
+		})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/auth",
+		func(w http.ResponseWriter, r *http.Request) {
+			issuer := tas.issuer
+			if issuer == "" {
+				issuer = *svrURL + "/auth"
+			}
+			asm := map[string]any{
+				"issuer":                 issuer,
+				"authorization_endpoint": *svrURL + "/auth/authorize",
+				"token_endpoint":         *svrURL + "/auth/token",
+				"registration_endpoint":  *svrURL + "/auth/register",
+			}
+			if !tas.noPKCE {
+				asm["code_challenge_methods_supported"] = []string{"S256"}
+			}
+			writeJSON(w, asm)
+		})
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		var meta struct {
+			RedirectURIs []string `json:"redirect_uris"`
+		}
+		json.NewDecoder(r.Body).Decode(&meta)
+
+		tas.mu.Lock()
+		tas.registered += 1
+		tas.redirectURI = meta.RedirectURIs[0]
+		tas.clientID = fmt.Sprintf("client-%d", tas.registered)
+		clientID := tas.clientID
+		tas.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]any{"client_id": clientID})
+	})
+	mux.HandleFunc("/auth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		tas.mu.Lock()
+		defer tas.mu.Unlock()
+
+		if q.Get("redirect_uri") != tas.redirectURI || q.Get("code_challenge_method") != "S256" ||
+			q.Get("resource") != tas.resourceURL(*svrURL) {
+
+			http.Error(w, "bad authorization request", http.StatusBadRequest)
+			return
+		}
+		tas.authorized += 1
+		code := fmt.Sprintf("code-%d", tas.authorized)
+		tas.challenges[code] = q.Get("code_challenge")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{
+			"code":  {code},
+			"state": {q.Get("state")},
+		}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		tas.mu.Lock()
+		defer tas.mu.Unlock()
+
+		if r.Form.Get("client_id") != tas.clientID {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, map[string]any{"error": "invalid_client"})
+			return
+		}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+			if tas.challenges[r.Form.Get("code")] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]any{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]any{"error": "invalid_grant"})
+				return
+			}
+			tas.refreshed += 1
+		}
+		writeJSON(w, map[string]any{
+			"access_token":  tas.newToken(),
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		tas.mu.Lock()
+		ok := tas.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		tas.mu.Unlock()
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer resource_metadata="%s/.well-known/oauth-protected-resource/mcp"`,
+				*svrURL))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mcpHandler.ServeHTTP(w, r)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mcp" &&
+			(r.Header.Get("Authorization") != "" || r.Header.Get("X-Secret") != "") {
+
+			tas.mu.Lock()
+			tas.leaked += 1
+			tas.mu.Unlock()
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// testOAuth uses a temporary OAuth cache and a browser which follows redirects until the end of
+// the test; it returns the number of times the browser was opened.
+func testOAuth(t *testing.T) *int {
+	t.Helper()
+
+	cf, ob := oauthCacheFile, openBrowser
+	t.Cleanup(func() {
+		oauthCacheFile = cf
+		openBrowser = ob
+	})
+
+	cacheFile := filepath.Join(t.TempDir(), "oauth.json")
+	oauthCacheFile = func() (string, error) { return cacheFile, nil }
+
+	var browsed int
+	openBrowser = func(authURL string) error {
+		browsed += 1
+		go func() {
+			resp, err := http.Get(authURL)
+			if err != nil {
+				t.Errorf("Get(%s) failed with %s", authURL, err)
+			} else {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+	return &browsed
+}
+
+func newTestAuthServer(tas *testAuthServer) *httptest.Server {
+	tas.challenges = map[string]string{}
+	tas.tokens = map[string]bool{}
+
+	var svrURL string
+	svr := httptest.NewServer(tas.handler(&svrURL,
+		mcpsvr.NewStreamableHTTPServer(newAllCapsServer())))
+	svrURL = svr.URL
+	return svr
+}
+
+func TestOAuth(t *testing.T) {
+	browsed := testOAuth(t)
+
+	tas := &testAuthServer{}
+	svr := newTestAuthServer(tas)
+	defer svr.Close()
+
+	cases := []struct {
+		revoke       bool
+		revokeClient bool
+		forgetToken  bool
+		registered   int
+		authorized   int
+		refreshed    int
+	}{
+		{registered: 1, authorized: 1},
+		// The cached token is used.
+		{registered: 1, authorized: 1},
+		// The token is refreshed.
+		{revoke: true, registered: 1, authorized: 1, refreshed: 1},
+		// The client is rejected when refreshing the token, so a new client is registered.
+		{revoke: true, revokeClient: true, registered: 2, authorized: 2, refreshed: 1},
+		// The client is rejected after authorizing access, so a new client is registered and
+		// access is authorized again.
+		{revoke: true, revokeClient: true, forgetToken: true, registered: 3, authorized: 4,
+			refreshed: 1},
+	}
+
+	for i, c := range cases {
+		if c.revoke {
+			tas.revokeTokens()
+		}
+		if c.revokeClient {
+			tas.revokeClient()
+		}
+		if c.forgetToken {
+			err := updateOAuthCache(func(cache *oauthCache) {
+				clear(cache.Tokens)
+			})
+			if err != nil {
+				t.Fatalf("updateOAuthCache() failed with %s", err)
+			}
+		}
+
+		lst, err := ListRemote(context.Background(), Remote{URL: svr.URL + "/mcp"}, ListTools)
+		if err != nil {
+			t.Fatalf("ListRemote(%d) failed with %s", i, err)
+		} else if len(lst.Tools) != 2 {
+			t.Errorf("ListRemote(%d) got %d tools want 2", i, len(lst.Tools))
+		}
+
+		tas.mu.Lock()
+		if tas.registered != c.registered || tas.authorized != c.authorized ||
+			tas.refreshed != c.refreshed {
+
+			t.Errorf("ListRemote(%d) got %d %d %d want %d %d %d", i, tas.registered,
+				tas.authorized, tas.refreshed, c.registered, c.authorized, c.refreshed)
+		}
+		tas.mu.Unlock()
+
+		if *browsed != c.authorized {
+			t.Errorf("ListRemote(%d) opened browser %d times want %d", i, *browsed,
+				c.authorized)
+		}
+	}
+}
+
+func TestOAuthServers(t *testing.T) {
+	testOAuth(t)
+
+	cases := []struct {
+		headers  bool
+		noPKCE   bool
+		resource string
+		issuer   string
+		fail     bool
+	}{
+		{},
+		// Headers for the server are not sent to the authorization server, and a static bearer
+		// token is replaced by the token from OAuth.
+		{headers: true},
+		{noPKCE: true, fail: true},
+		{resource: "/other", fail: true},
+		{resource: "https://example.com/mcp", fail: true},
+		{resource: "/"},
+		{issuer: "https://example.com/auth", fail: true},
+	}
+
+	for i, c := range cases {
+		tas := &testAuthServer{noPKCE: c.noPKCE, issuer: c.issuer}
+		svr := newTestAuthServer(tas)
+		if strings.HasPrefix(c.resource, "/") {
+			tas.resource = svr.URL + c.resource
+		} else {
+			tas.resource = c.resource
+		}
+
+		rmt := Remote{URL: svr.URL + "/mcp"}
+		if c.headers {
+			rmt.Headers = []Header{{Name: "X-Secret", Source: "secret"}, BearerHeader("static")}
+		}
+		_, err := ListRemote(context.Background(), rmt, ListTools)
+		if c.fail {
+			if err == nil {
+				t.Errorf("ListRemote(%d) did not fail", i)
+			}
+		} else if err != nil {
+			t.Errorf("ListRemote(%d) failed with %s", i, err)
+		}
+
+		tas.mu.Lock()
+		if tas.leaked != 0 {
+			t.Errorf("ListRemote(%d) sent credentials to the authorization server %d times", i,
+				tas.leaked)
+		}
+		tas.mu.Unlock()
+		svr.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	promptImpl = mcp.Implementation{
+		Name:    "gmcpt-prompt-client",
+		Version: "0.1.0",
+	}
+)
+
+func PromptLocal(ctx context.Context, lcl Local, name string,
+	promptArgs []string) (*mcp.GetPromptResult, error) {
+
+	var ret *mcp.GetPromptResult
+	err := withLocal(ctx, &promptImpl, lcl,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = prompt(ctx, sess, name, promptArgs)
+			return err
+		})
+	return ret, err
+}
+
+func PromptRemote(ctx context.Context, rmt Remote, name string, promptArgs []string) (
+	*mcp.GetPromptResult, error) {
+
+	var ret *mcp.GetPromptResult
+	err := withRemote(ctx, &promptImpl, rmt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = prompt(ctx, sess, name, promptArgs)
+			return err
+		})
+	return ret, err
+}
+
+func prompt(ctx context.Context, sess *mcp.ClientSession, name string,
+	promptArgs []string) (*mcp.GetPromptResult, error) {
+
+	if sess.InitializeResult().Capabilities.Prompts == nil {
+		return nil, fmt.Errorf("server does not support prompts")
+	}
+
+	var prpt *mcp.Prompt
+	for pr, err := range sess.Prompts(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("listing prompts: %s", err)
+		}
+		if pr.Name == name {
+			prpt = pr
+			break
+		}
+	}
+	if prpt == nil {
+		return nil, fmt.Errorf("prompt not found: %s", name)
+	}
+
+	args, err := PromptArguments(prpt, promptArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := sess.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: args})
+	if err != nil {
+		return nil, fmt.Errorf("getting prompt %s: %s", name, err)
+	}
+	return ret, nil
+}
+
+// PromptArguments converts key=value strings into prompt arguments, checking them against the
+// arguments declared by the prompt.
+func PromptArguments(prpt *mcp.Prompt, promptArgs []string) (map[string]string, error) {
+	args := map[string]string{}
+	for _, pa := range promptArgs {
+		key, val, ok := strings.Cut(pa, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("argument must be key=value: %s", pa)
+		}
+
+		if !slices.ContainsFunc(prpt.Arguments,
+			func(arg *mcp.PromptArgument) bool { return arg.Name == key }) {
+
+			return nil, fmt.Errorf("unknown argument: %s", key)
+		}
+		args[key] = val
+	}
+
+	for _, arg := range prpt.Arguments {
+		if _, ok := args[arg.Name]; arg.Required && !ok {
+			return nil, fmt.Errorf("missing required argument: %s", arg.Name)
+		}
+	}
+
+	return args, nil
+}
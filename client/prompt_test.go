@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"testing"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestPromptArguments(t *testing.T) {
+	prpt := &mcp.Prompt{
+		Name: "test",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "name", Required: true},
+			{Name: "style"},
+		},
+	}
+
+	cases := []struct {
+		args []string
+		want map[string]string
+		fail bool
+	}{
+		{args: []string{"name=World"}, want: map[string]string{"name": "World"}},
+		{args: []string{"name="}, want: map[string]string{"name": ""}},
+		{
+			args: []string{"style=a=b", "name=x"},
+			want: map[string]string{"name": "x", "style": "a=b"},
+		},
+		{args: []string{"style=formal"}, fail: true},
+		{args: []string{"name=x", "unknown=y"}, fail: true},
+		{args: []string{"name"}, fail: true},
+		{args: []string{"=x"}, fail: true},
+	}
+
+	for _, c := range cases {
+		got, err := PromptArguments(prpt, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("PromptArguments(%v) did not fail", c.args)
+			}
+		} else if err != nil {
+			t.Errorf("PromptArguments(%v) failed with %s", c.args, err)
+		} else if !maps.Equal(got, c.want) {
+			t.Errorf("PromptArguments(%v) got %v want %v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestPromptRemote(t *testing.T) {
+	tsvr := mcpsvr.NewMCPServer("test-prompt-server", "0.1.0",
+		mcpsvr.WithPromptCapabilities(true))
+	tsvr.AddPrompt(mcpgo.NewPrompt("greet",
+		mcpgo.WithPromptDescription("generates a greeting"),
+		mcpgo.WithArgument("name", mcpgo.RequiredArgument())),
+		func(ctx context.Context, req mcpgo.GetPromptRequest) (*mcpgo.GetPromptResult, error) {
+			return mcpgo.NewGetPromptResult("a greeting message",
+				[]mcpgo.PromptMessage{
+					mcpgo.NewPromptMessage(mcpgo.RoleUser,
+						mcpgo.NewTextContent(fmt.Sprintf("Hello, %s!",
+							req.Params.Arguments["name"]))),
+				},
+			), nil
+		})
+
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	cases := []struct {
+		name string
+		args []string
+		want string
+		fail bool
+	}{
+		{name: "greet", args: []string{"name=World"}, want: "Hello, World!"},
+		{name: "greet", fail: true},
+		{name: "farewell", args: []string{"name=World"}, fail: true},
+	}
+
+	url := svr.URL + "/mcp"
+	for _, c := range cases {
+		ret, err := PromptRemote(context.Background(), Remote{URL: url}, c.name, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("PromptRemote(%s, %v) did not fail", c.name, c.args)
+			}
+		} else if err != nil {
+			t.Errorf("PromptRemote(%s, %v) failed with %s", c.name, c.args, err)
+		} else if len(ret.Messages) != 1 {
+			t.Errorf("PromptRemote(%s, %v) got %d messages want 1", c.name, c.args,
+				len(ret.Messages))
+		} else if ret.Messages[0].Role != "user" {
+			t.Errorf("PromptRemote(%s, %v) got role %s want user", c.name, c.args,
+				ret.Messages[0].Role)
+		} else if tc, ok := ret.Messages[0].Content.(*mcp.TextContent); !ok {
+			t.Errorf("PromptRemote(%s, %v) expected TextContent, got %T", c.name, c.args,
+				ret.Messages[0].Content)
+		} else if tc.Text != c.want {
+			t.Errorf("PromptRemote(%s, %v) got %s want %s", c.name, c.args, tc.Text, c.want)
+		}
+	}
+}
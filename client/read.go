@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/yosida95/uritemplate/v3"
+)
+
+var (
+	readImpl = mcp.Implementation{
+		Name:    "gmcpt-read-client",
+		Version: "0.1.0",
+	}
+)
+
+func ReadLocal(ctx context.Context, lcl Local, uri string) (
+	*mcp.ReadResourceResult, error) {
+
+	var ret *mcp.ReadResourceResult
+	err := withLocal(ctx, &readImpl, lcl,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = read(ctx, sess, uri)
+			return err
+		})
+	return ret, err
+}
+
+func ReadRemote(ctx context.Context, rmt Remote, uri string) (
+	*mcp.ReadResourceResult, error) {
+
+	var ret *mcp.ReadResourceResult
+	err := withRemote(ctx, &readImpl, rmt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = read(ctx, sess, uri)
+			return err
+		})
+	return ret, err
+}
+
+func read(ctx context.Context, sess *mcp.ClientSession, uri string) (*mcp.ReadResourceResult,
+	error) {
+
+	if sess.InitializeResult().Capabilities.Resources == nil {
+		return nil, fmt.Errorf("server does not support resources")
+	}
+
+	ret, err := sess.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		return nil, fmt.Errorf("reading resource %s: %s", uri, err)
+	}
+	return ret, nil
+}
+
+// ExpandTemplate expands a resource URI template using key=value strings for its variables.
+func ExpandTemplate(tmpl string, tmplArgs []string) (string, error) {
+	t, err := uritemplate.New(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %s: %s", tmpl, err)
+	}
+
+	vals := uritemplate.Values{}
+	for _, ta := range tmplArgs {
+		key, val, ok := strings.Cut(ta, "=")
+		if !ok || key == "" {
+			return "", fmt.Errorf("argument must be key=value: %s", ta)
+		}
+		if !slices.Contains(t.Varnames(), key) {
+			return "", fmt.Errorf("unknown template variable: %s", key)
+		}
+		vals.Set(key, uritemplate.String(val))
+	}
+
+	return t.Expand(vals)
+}
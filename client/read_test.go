@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	cases := []struct {
+		tmpl string
+		args []string
+		want string
+		fail bool
+	}{
+		{tmpl: "file:///{path}", args: []string{"path=readme.txt"}, want: "file:///readme.txt"},
+		{tmpl: "file:///{path}", args: []string{"path=a/b"}, want: "file:///a%2Fb"},
+		{tmpl: "file:///{+path}", args: []string{"path=a/b"}, want: "file:///a/b"},
+		{
+			tmpl: "db://{table}/{id}",
+			args: []string{"table=users", "id=42"},
+			want: "db://users/42",
+		},
+		{
+			tmpl: "search://docs{?q,limit}",
+			args: []string{"q=hello world"},
+			want: "search://docs?q=hello%20world",
+		},
+		{tmpl: "file:///{path}", args: []string{"name=x"}, fail: true},
+		{tmpl: "file:///{path}", args: []string{"path"}, fail: true},
+		{tmpl: "file:///{path", args: []string{"path=x"}, fail: true},
+	}
+
+	for _, c := range cases {
+		got, err := ExpandTemplate(c.tmpl, c.args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("ExpandTemplate(%s, %v) did not fail", c.tmpl, c.args)
+			}
+		} else if err != nil {
+			t.Errorf("ExpandTemplate(%s, %v) failed with %s", c.tmpl, c.args, err)
+		} else if got != c.want {
+			t.Errorf("ExpandTemplate(%s, %v) got %s want %s", c.tmpl, c.args, got, c.want)
+		}
+	}
+}
+
+func TestReadRemote(t *testing.T) {
+	tsvr := mcpsvr.NewMCPServer("test-read-server", "0.1.0",
+		mcpsvr.WithResourceCapabilities(false, false))
+	tsvr.AddResource(mcpgo.NewResource("file:///test.txt", "test.txt"),
+		func(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents,
+			error) {
+
+			return []mcpgo.ResourceContents{
+				mcpgo.TextResourceContents{URI: "file:///test.txt", Text: "test"},
+			}, nil
+		})
+	tsvr.AddResource(mcpgo.NewResource("file:///test.bin", "test.bin"),
+		func(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents,
+			error) {
+
+			return []mcpgo.ResourceContents{
+				mcpgo.BlobResourceContents{
+					URI:      "file:///test.bin",
+					MIMEType: "application/octet-stream",
+					Blob:     "AAEC",
+				},
+			}, nil
+		})
+
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	url := svr.URL + "/mcp"
+	ret, err := ReadRemote(context.Background(), Remote{URL: url}, "file:///test.txt")
+	if err != nil {
+		t.Errorf("ReadRemote(file:///test.txt) failed with %s", err)
+	} else if len(ret.Contents) != 1 || ret.Contents[0].Text != "test" {
+		t.Errorf("ReadRemote(file:///test.txt) got %#v", ret.Contents)
+	}
+
+	ret, err = ReadRemote(context.Background(), Remote{URL: url}, "file:///test.bin")
+	if err != nil {
+		t.Errorf("ReadRemote(file:///test.bin) failed with %s", err)
+	} else if len(ret.Contents) != 1 || string(ret.Contents[0].Blob) != "\x00\x01\x02" {
+		t.Errorf("ReadRemote(file:///test.bin) got %#v", ret.Contents)
+	}
+
+	_, err = ReadRemote(context.Background(), Remote{URL: url}, "file:///missing.txt")
+	if err == nil {
+		t.Error("ReadRemote(file:///missing.txt) did not fail")
+	}
+}
@@ -2,34 +2,154 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
+const (
+	StdioTransport      = "stdio"
+	StreamableTransport = "streamable-http"
+	SSETransport        = "sse"
+)
+
+// Remote describes how to connect to a remote server. Transport may be StreamableTransport or
+// SSETransport to use that transport instead of detecting it.
+type Remote struct {
+	URL       string
+	APIKey    string
+	Header    string // header for the API key; Authorization: Bearer if empty
+	Transport string
+	TLS       *tls.Config
+
+	Headers []Header
+}
+
+// Local describes how to run a local server: Dir is the working directory and Env are additional
+// KEY=VALUE environment variables for Command.
+type Local struct {
+	Command string
+	Args    []string
+	Dir     string
+	Env     []string
+}
+
 type SessionManager struct {
-	url    string
-	apiKey string
-	header string
-	sse    bool
+	url     string
+	headers []Header
+	creds   []*credential
+	sse     bool
+	tls     *tls.Config
+	cmd     string
+	args    []string
+	dir     string
+	env     []string
+	stderr  io.Writer
 
-	sess  *mcp.ClientSession
-	retry bool
+	mu         sync.Mutex
+	sess       *mcp.ClientSession
+	clnt       *mcp.Client
+	connecting chan struct{}
+	detected   string
+	retry      bool
+	restart    bool
+	shutdown   bool
+	backoff    time.Duration
+	done       context.Context
+	stop       context.CancelFunc
+	onConnect  func(ctx context.Context, sess *mcp.ClientSession) error
+	httpOnce   sync.Once
+	base       http.RoundTripper
+	oauth      *oauthTransport
 }
 
-func NewSessionManager(url, apiKey, header string, sse bool) SessionManager {
+var errShutdown = errors.New("session manager is shut down")
+
+func NewSessionManager(rmt Remote) SessionManager {
+	headers := slices.Clone(rmt.Headers)
+	if rmt.APIKey != "" {
+		if rmt.Header == "" {
+			headers = append(headers, BearerHeader(rmt.APIKey))
+		} else {
+			headers = append(headers, Header{Name: rmt.Header, Source: rmt.APIKey})
+		}
+	}
+
+	var creds []*credential
+	for _, hdr := range headers {
+		creds = append(creds, newCredential(hdr.Source))
+	}
+
+	var detected string
+	if rmt.Transport == StreamableTransport {
+		detected = StreamableTransport
+	}
+
 	return SessionManager{
-		url:    url,
-		apiKey: apiKey,
-		header: header,
-		sse:    sse,
+		url:      rmt.URL,
+		headers:  headers,
+		creds:    creds,
+		sse:      rmt.Transport == SSETransport,
+		tls:      rmt.TLS,
+		detected: detected,
 	}
 }
 
+func NewLocalSessionManager(cmd string, args []string) SessionManager {
+	return SessionManager{
+		cmd:  cmd,
+		args: args,
+	}
+}
+
+// OnConnect sets a function to be called each time a new session is established, including
+// after reconnecting, before the session is used.
+func (sm *SessionManager) OnConnect(
+	onConnect func(ctx context.Context, sess *mcp.ClientSession) error) {
+
+	sm.onConnect = onConnect
+}
+
+// CommandOptions sets the working directory, additional environment variables, and where
+// standard error goes for the local server command.
+func (sm *SessionManager) CommandOptions(dir string, env []string, stderr io.Writer) {
+	sm.dir = dir
+	sm.env = env
+	sm.stderr = stderr
+}
+
+// RestartOnExit restarts the local server command, using the same backoff as WithSession, if it
+// exits after a session has been established.
+func (sm *SessionManager) RestartOnExit() {
+	sm.restart = true
+	sm.done, sm.stop = context.WithCancel(context.Background())
+}
+
 func (sm *SessionManager) transport() mcp.Transport {
-	if sm.sse {
+	if sm.cmd != "" {
+		cmd := exec.Command(sm.cmd, sm.args...)
+		cmd.Dir = sm.dir
+		if len(sm.env) > 0 {
+			cmd.Env = append(os.Environ(), sm.env...)
+		}
+		cmd.Stderr = sm.stderr
+		return &mcp.CommandTransport{
+			Command: cmd,
+		}
+	}
+
+	if sm.sse || sm.detected == SSETransport {
 		return &mcp.SSEClientTransport{
 			Endpoint:   sm.url,
 			HTTPClient: sm.httpClient(),
@@ -42,57 +162,383 @@ func (sm *SessionManager) transport() mcp.Transport {
 	}
 }
 
+// Transport returns the transport used for the server, or "" if the transport of a remote server
+// has not been detected yet.
+func (sm *SessionManager) Transport() string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.cmd != "" {
+		return StdioTransport
+	} else if sm.sse {
+		return SSETransport
+	}
+	return sm.detected
+}
+
+// connect detects the transport of a remote server, unless SSE was requested, the first time it
+// connects: Streamable HTTP is tried first, falling back to SSE if the server responds to the
+// initialize request with a client error. The detected transport is used when reconnecting.
+func (sm *SessionManager) connect(ctx context.Context, clnt *mcp.Client) (*mcp.ClientSession,
+	error) {
+
+	if sm.cmd != "" || sm.sse || sm.detected != "" {
+		return clnt.Connect(ctx, sm.transport(), nil)
+	}
+
+	cet := &clientErrorTransport{RoundTripper: sm.httpClient().Transport}
+	if cet.RoundTripper == nil {
+		cet.RoundTripper = http.DefaultTransport
+	}
+	sess, err := clnt.Connect(ctx,
+		&mcp.StreamableClientTransport{
+			Endpoint:   sm.url,
+			HTTPClient: &http.Client{Transport: cet},
+		}, nil)
+	if err == nil {
+		sm.setDetected(StreamableTransport)
+		slog.Info("detected transport", "url", sm.url, "transport", sm.detected)
+		return sess, nil
+	} else if !cet.clientError.Load() || ctx.Err() != nil {
+		return nil, err
+	}
+
+	slog.Info("falling back to sse", "url", sm.url, "error", err.Error())
+
+	sess, sseErr := clnt.Connect(ctx,
+		&mcp.SSEClientTransport{
+			Endpoint:   sm.url,
+			HTTPClient: sm.httpClient(),
+		}, nil)
+	if sseErr != nil {
+		return nil, fmt.Errorf("streamable http: %s; sse: %s", err, sseErr)
+	}
+
+	sm.setDetected(SSETransport)
+	slog.Info("detected transport", "url", sm.url, "transport", sm.detected)
+	return sess, nil
+}
+
+func (sm *SessionManager) setDetected(transport string) {
+	sm.mu.Lock()
+	sm.detected = transport
+	sm.mu.Unlock()
+}
+
+// clientErrorTransport records whether any POST got a 4xx response, other than 401 Unauthorized
+// which is a failure to authorize rather than a sign of the wrong transport.
+type clientErrorTransport struct {
+	http.RoundTripper
+	clientError atomic.Bool
+}
+
+func (cet *clientErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := cet.RoundTripper.RoundTrip(req)
+	if err == nil && req.Method == http.MethodPost && resp.StatusCode >= 400 &&
+		resp.StatusCode < 500 && resp.StatusCode != http.StatusUnauthorized {
+
+		cet.clientError.Store(true)
+	}
+	return resp, err
+}
+
 func (sm *SessionManager) WithSession(ctx context.Context, clnt *mcp.Client,
 	with func(ctx context.Context, sess *mcp.ClientSession) error) error {
 
-	if sm.sess != nil && sm.sess.Ping(ctx, nil) != nil {
-		sm.sess.Close()
-		sm.sess = nil
+	sess, err := sm.session(ctx, clnt)
+	if err != nil {
+		return err
 	}
+	return with(ctx, sess)
+}
+
+// session returns the current session after checking that it is still alive, or establishes a new
+// session using clnt. Only one caller connects at a time; other callers wait for it, or for ctx to
+// be done. The lock is not held while pinging or connecting, so callers using a live session are
+// not delayed.
+func (sm *SessionManager) session(ctx context.Context, clnt *mcp.Client) (*mcp.ClientSession,
+	error) {
 
-	if sm.sess == nil {
-		backoff := 250 * time.Millisecond
-		for {
-			var err error
-			sm.sess, err = clnt.Connect(ctx, sm.transport(), nil)
-			if err == nil {
-				break
-			} else if !sm.retry {
-				return err
+	for {
+		sm.mu.Lock()
+		if sm.shutdown {
+			sm.mu.Unlock()
+			return nil, errShutdown
+		}
+		sess := sm.sess
+		connecting := sm.connecting
+		if sess == nil && connecting == nil {
+			break
+		}
+		sm.mu.Unlock()
+
+		if sess != nil {
+			if sess.Ping(ctx, nil) == nil {
+				return sess, nil
+			} else if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
+			sm.endSession(sess)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-connecting:
+		}
+	}
+
+	connecting := make(chan struct{})
+	sm.connecting = connecting
+	sm.clnt = clnt
+	retry := sm.retry
+	sm.mu.Unlock()
 
-			slog.Info("with session", "backoff", backoff, "error", err.Error())
+	sess, err := sm.dial(ctx, clnt, retry)
 
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(backoff):
-				backoff = min(backoff*2, 30*time.Second)
+	sm.mu.Lock()
+	sm.connecting = nil
+	close(connecting)
+	if err == nil && sm.shutdown {
+		err = errShutdown
+	}
+	if err == nil {
+		sm.sess = sess
+		sm.retry = true
+		if sm.restart && sm.cmd != "" {
+			go sm.watch(sess, time.Now())
+		}
+	}
+	sm.mu.Unlock()
+
+	if err != nil {
+		if sess != nil {
+			sess.Close()
+		}
+		return nil, err
+	}
+	return sess, nil
+}
+
+// dial connects, retrying with an increasing backoff if retry is true, and then calls onConnect.
+func (sm *SessionManager) dial(ctx context.Context, clnt *mcp.Client,
+	retry bool) (*mcp.ClientSession, error) {
+
+	backoff := 250 * time.Millisecond
+	for {
+		sess, err := sm.connect(ctx, clnt)
+		if err == nil {
+			if sm.onConnect != nil {
+				err = sm.onConnect(ctx, sess)
+				if err != nil {
+					sess.Close()
+					return nil, err
+				}
 			}
+			return sess, nil
+		} else if !retry {
+			return nil, err
 		}
+
+		slog.Info("with session", "backoff", backoff, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}
+}
+
+// endSession closes sess, and, if it is the current session, clears it so that the next caller
+// reconnects. Sessions are closed without holding the lock because closing waits for handlers,
+// which may need a session, to return.
+func (sm *SessionManager) endSession(sess *mcp.ClientSession) {
+	sm.mu.Lock()
+	if sm.sess == sess {
+		sm.sess = nil
 	}
+	sm.mu.Unlock()
 
-	sm.retry = true
-	return with(ctx, sm.sess)
+	sess.Close()
 }
 
-func (sm *SessionManager) httpClient() *http.Client {
-	if sm.apiKey != "" {
-		return &http.Client{Transport: sm}
+// watch restarts the command, using the current client, if sess ends while it is still the
+// current session. Commands which exit soon after starting are restarted with an increasing
+// backoff.
+func (sm *SessionManager) watch(sess *mcp.ClientSession, started time.Time) {
+	sess.Wait()
+
+	sm.mu.Lock()
+	exited := sm.sess == sess && !sm.shutdown
+	if exited {
+		sm.sess = nil
+	}
+	if time.Since(started) > 30*time.Second || sm.backoff == 0 {
+		sm.backoff = 250 * time.Millisecond
+	} else {
+		sm.backoff = min(sm.backoff*2, 30*time.Second)
+	}
+	backoff := sm.backoff
+	clnt := sm.clnt
+	sm.mu.Unlock()
+
+	if !exited {
+		return
 	}
 
-	return http.DefaultClient
+	slog.Warn("command exited, restarting", "cmd", sm.cmd, "backoff", backoff)
+
+	select {
+	case <-sm.done.Done():
+		return
+	case <-time.After(backoff):
+	}
+
+	_, err := sm.session(sm.done, clnt)
+	if err != nil && sm.done.Err() == nil {
+		slog.Error("restarting command", "cmd", sm.cmd, "error", err)
+	}
 }
 
+func (sm *SessionManager) httpClient() *http.Client {
+	sm.httpOnce.Do(func() {
+		sm.base = http.DefaultTransport
+		if sm.tls != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = sm.tls
+			sm.base = t
+		}
+
+		// Requests for the authorization server are sent without the headers, which are only
+		// for the server.
+		server := sm.base
+		if len(sm.headers) > 0 {
+			server = sm
+		}
+		sm.oauth = newOAuthTransport(sm.base, server, sm.url)
+	})
+
+	return &http.Client{Transport: sm.oauth}
+}
+
+// RoundTrip adds the headers to a request to the server; a token from OAuth replaces an
+// Authorization header. If the server responds with 401 Unauthorized, the output of credential
+// helpers is forgotten, and the request is sent once more with their new output.
 func (sm *SessionManager) RoundTrip(req *http.Request) (*http.Response, error) {
+	vals, err := sm.credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sm.base.RoundTrip(sm.addHeaders(req, vals))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized ||
+		(req.Body != nil && req.GetBody == nil) {
+
+		return resp, err
+	}
+
+	var forgot bool
+	for i, cred := range sm.creds {
+		forgot = cred.forget(vals[i]) || forgot
+	}
+	if !forgot {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	vals, err = sm.credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = sm.addHeaders(req, vals)
+	if req.Body != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sm.base.RoundTrip(req)
+}
+
+func (sm *SessionManager) credentials(ctx context.Context) ([]string, error) {
+	var vals []string
+	for i, hdr := range sm.headers {
+		val, err := sm.creds[i].get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %s", hdr.Name, err)
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+func (sm *SessionManager) addHeaders(req *http.Request, vals []string) *http.Request {
+	auth := req.Header.Get("Authorization") != ""
 	req = req.Clone(req.Context())
-	req.Header.Set(sm.header, sm.apiKey)
-	return http.DefaultTransport.RoundTrip(req)
+	for i, hdr := range sm.headers {
+		if auth && http.CanonicalHeaderKey(hdr.Name) == "Authorization" {
+			continue
+		}
+		req.Header.Set(hdr.Name, hdr.Prefix+vals[i])
+	}
+	return req
 }
 
+// Close closes the current session, if any; the next call to WithSession establishes a new
+// session, and a local server command is still restarted if it exits after that.
 func (sm *SessionManager) Close() {
-	if sm.sess != nil {
-		sm.sess.Close()
-		sm.sess = nil
+	sm.mu.Lock()
+	sess := sm.sess
+	sm.sess = nil
+	sm.mu.Unlock()
+
+	if sess != nil {
+		sess.Close()
+	}
+}
+
+// Shutdown closes the current session, if any, and stops restarting the local server command;
+// WithSession fails after it is shut down.
+func (sm *SessionManager) Shutdown() {
+	sm.mu.Lock()
+	sm.shutdown = true
+	sm.mu.Unlock()
+
+	if sm.stop != nil {
+		sm.stop()
 	}
+	sm.Close()
+}
+
+func withLocal(ctx context.Context, impl *mcp.Implementation, lcl Local,
+	with func(ctx context.Context, sess *mcp.ClientSession) error) error {
+
+	cmd := exec.Command(lcl.Command, lcl.Args...)
+	cmd.Dir = lcl.Dir
+	if len(lcl.Env) > 0 {
+		cmd.Env = append(os.Environ(), lcl.Env...)
+	}
+	sess, err := mcp.NewClient(impl, nil).Connect(ctx,
+		&mcp.CommandTransport{
+			Command: cmd,
+		}, nil)
+	if err != nil {
+		return fmt.Errorf("connecting to command: %s", err)
+	}
+	defer sess.Close()
+
+	return with(ctx, sess)
+}
+
+func withRemote(ctx context.Context, impl *mcp.Implementation, rmt Remote,
+	with func(ctx context.Context, sess *mcp.ClientSession) error) error {
+
+	sm := NewSessionManager(rmt)
+	defer sm.Close()
+
+	return sm.WithSession(ctx, mcp.NewClient(impl, nil), with)
 }
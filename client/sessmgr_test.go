@@ -3,9 +3,13 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +19,43 @@ import (
 
 func init() {
 	slog.SetLogLoggerLevel(slog.LevelError)
+
+	if os.Getenv("GMCPT_TEST_SERVER") != "" {
+		runTestServer()
+	}
+}
+
+// runTestServer runs a local server, using this test binary, with an exit tool which writes
+// GMCPT_TEST_SERVER to standard error and then exits.
+func runTestServer() {
+	svr := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "0.1.0"}, nil)
+	mcp.AddTool(svr, &mcp.Tool{Name: "exit"},
+		func(ctx context.Context, req *mcp.CallToolRequest, in struct{}) (*mcp.CallToolResult,
+			any, error) {
+
+			fmt.Fprintln(os.Stderr, os.Getenv("GMCPT_TEST_SERVER"))
+			os.Exit(1)
+			return nil, nil, nil
+		})
+	svr.Run(context.Background(), &mcp.StdioTransport{})
+	os.Exit(0)
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
 }
 
 func TestWithSessionRetrySuccess(t *testing.T) {
@@ -32,7 +73,7 @@ func TestWithSessionRetrySuccess(t *testing.T) {
 	}))
 	defer svr.Close()
 
-	sm := NewSessionManager(svr.URL+"/mcp", "", "", false)
+	sm := NewSessionManager(Remote{URL: svr.URL + "/mcp"})
 	sm.retry = true
 
 	err := sm.WithSession(context.Background(),
@@ -61,10 +102,11 @@ func TestWithSessionRetryContextCancel(t *testing.T) {
 	}))
 	defer svr.Close()
 
-	sm := NewSessionManager(svr.URL+"/mcp", "", "", false)
+	sm := NewSessionManager(Remote{URL: svr.URL + "/mcp"})
 	sm.retry = true
 
-	ctx, _ := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
 	err := sm.WithSession(ctx,
 		mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil),
 		func(ctx context.Context, sess *mcp.ClientSession) error {
@@ -76,3 +118,119 @@ func TestWithSessionRetryContextCancel(t *testing.T) {
 		t.Errorf("WithSession() got %s want %s", err, context.DeadlineExceeded)
 	}
 }
+
+func TestWithSessionRestart(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable() failed with %s", err)
+	}
+
+	var stderr syncBuffer
+	sm := NewLocalSessionManager(exe, nil)
+	sm.CommandOptions(t.TempDir(), []string{"GMCPT_TEST_SERVER=exiting"}, &stderr)
+	sm.RestartOnExit()
+	defer sm.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Closing the session must not stop the command from being restarted later.
+	clnt := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil)
+	err = sm.WithSession(ctx, clnt,
+		func(ctx context.Context, sess *mcp.ClientSession) error { return nil })
+	if err != nil {
+		t.Fatalf("WithSession() failed with %s", err)
+	}
+	sm.Close()
+
+	var first *mcp.ClientSession
+	err = sm.WithSession(ctx, clnt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			first = sess
+			_, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: "exit"})
+			if err == nil {
+				t.Error("CallTool(exit) did not fail")
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("WithSession() failed with %s", err)
+	}
+
+	for {
+		sm.mu.Lock()
+		sess := sm.sess
+		sm.mu.Unlock()
+
+		if sess != nil && sess != first {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("command was not restarted")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	if got := stderr.String(); got != "exiting\n" {
+		t.Errorf("stderr got %q want %q", got, "exiting\n")
+	}
+
+	sm.Shutdown()
+	err = sm.WithSession(ctx, clnt,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			t.Error("WithSession() should not call with")
+			return nil
+		})
+	if !errors.Is(err, errShutdown) {
+		t.Errorf("WithSession() got %v want %s", err, errShutdown)
+	}
+}
+
+func TestWithSessionDetect(t *testing.T) {
+	tsvr := mcpsvr.NewMCPServer("test-server", "0.1.0")
+	sseSvr := httptest.NewServer(mcpsvr.NewSSEServer(tsvr))
+	defer sseSvr.Close()
+	httpSvr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer httpSvr.Close()
+
+	cases := []struct {
+		url       string
+		transport string
+		fail      bool
+	}{
+		{url: sseSvr.URL + "/sse", transport: SSETransport},
+		{url: httpSvr.URL + "/mcp", transport: StreamableTransport},
+		{url: sseSvr.URL + "/missing", fail: true},
+	}
+
+	for _, c := range cases {
+		sm := NewSessionManager(Remote{URL: c.url})
+		err := sm.WithSession(context.Background(),
+			mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil),
+			func(ctx context.Context, sess *mcp.ClientSession) error {
+				return sess.Ping(ctx, nil)
+			})
+		if c.fail {
+			if err == nil {
+				t.Errorf("WithSession(%s) did not fail", c.url)
+			}
+		} else if err != nil {
+			t.Errorf("WithSession(%s) failed with %s", c.url, err)
+		} else if sm.Transport() != c.transport {
+			t.Errorf("Transport(%s) got %s want %s", c.url, sm.Transport(), c.transport)
+		} else {
+			// Reconnect using the detected transport.
+			sm.Close()
+			err = sm.WithSession(context.Background(),
+				mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil),
+				func(ctx context.Context, sess *mcp.ClientSession) error {
+					return sess.Ping(ctx, nil)
+				})
+			if err != nil {
+				t.Errorf("WithSession(%s) reconnect failed with %s", c.url, err)
+			}
+		}
+		sm.Close()
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig returns the TLS configuration for connecting to remote servers using a client
+// certificate and key for mutual TLS, a CA bundle to verify servers with instead of the system
+// roots, a server name to verify instead of the host in the URL, and a minimum TLS version of
+// 1.2 or 1.3. Any of these may be empty; if all are, the configuration is nil.
+func TLSConfig(certFile, keyFile, caFile, serverName, minVersion string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caFile == "" && serverName == "" && minVersion == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName: serverName,
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both a client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		buf, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %s", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("CA bundle: no certificates found in %s", caFile)
+		}
+	}
+
+	switch minVersion {
+	case "":
+	case "1.2":
+		cfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("minimum TLS version must be 1.2 or 1.3: %s", minVersion)
+	}
+
+	return cfg, nil
+}
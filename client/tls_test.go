@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mcpsvr "github.com/mark3labs/mcp-go/server"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed with %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.DNSNames = []string{name}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() failed with %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() failed with %s", err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (tc *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	certFile := filepath.Join(dir, name+".crt")
+	err := os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile(%s) failed with %s", certFile, err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() failed with %s", err)
+	}
+	keyFile := filepath.Join(dir, name+".key")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		0600)
+	if err != nil {
+		t.Fatalf("WriteFile(%s) failed with %s", keyFile, err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, 0)
+	caFile, _ := ca.write(t, dir, "ca")
+	svrCert := newTestCert(t, "mcp.internal", ca, x509.ExtKeyUsageServerAuth)
+	clntCert := newTestCert(t, "test-client", ca, x509.ExtKeyUsageClientAuth)
+	certFile, keyFile := clntCert.write(t, dir, "client")
+
+	svr := httptest.NewUnstartedServer(
+		mcpsvr.NewStreamableHTTPServer(mcpsvr.NewMCPServer("test-server", "0.1.0")))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	svr.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{svrCert.der},
+			PrivateKey:  svrCert.key,
+		}},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MaxVersion: tls.VersionTLS12,
+	}
+	svr.Config.ErrorLog = log.New(io.Discard, "", 0)
+	svr.StartTLS()
+	defer svr.Close()
+
+	cases := []struct {
+		cert, key, ca, serverName, minVersion string
+		fail                                  bool
+	}{
+		{cert: certFile, key: keyFile, ca: caFile, serverName: "mcp.internal"},
+		{cert: certFile, key: keyFile, ca: caFile, serverName: "mcp.internal", minVersion: "1.2"},
+		{cert: certFile, key: keyFile, ca: caFile, serverName: "mcp.internal", minVersion: "1.3",
+			fail: true},
+		{ca: caFile, serverName: "mcp.internal", fail: true},
+		{cert: certFile, key: keyFile, serverName: "mcp.internal", fail: true},
+		{cert: certFile, key: keyFile, ca: caFile, fail: true},
+		{cert: certFile, ca: caFile, fail: true},
+		{cert: certFile, key: keyFile, ca: caFile, minVersion: "1.1", fail: true},
+	}
+
+	for _, c := range cases {
+		cfg, err := TLSConfig(c.cert, c.key, c.ca, c.serverName, c.minVersion)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err = ListRemote(ctx, Remote{URL: svr.URL + "/mcp", TLS: cfg}, ListTools)
+			cancel()
+		}
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("TLSConfig(%v) did not fail", c)
+			}
+		} else if err != nil {
+			t.Errorf("TLSConfig(%v) failed with %s", c, err)
+		}
+	}
+}
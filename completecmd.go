@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func completeCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
+	var server, template string
+	var json bool
+	var flg config.Server
+
+	fs.StringVar(&server, "server", "", "name of server in configuration file")
+	fs.StringVar(&flg.URL, "url", "", "remote MCP server URL")
+	serverFlags(fs, &flg)
+	fs.StringVar(&template, "template", "", "resource template to complete a variable of")
+	fs.BoolVar(&json, "json", false, "output as JSON")
+
+	args, _ := parse()
+	args, cmd := splitCommand(args)
+	rmt, lcl := resolveServer(fs, server, &flg, cmd)
+
+	var ref *mcp.CompleteReference
+	if template != "" {
+		ref = &mcp.CompleteReference{Type: "ref/resource", URI: template}
+	} else if len(args) == 0 {
+		fatal("prompt name or -template is required")
+	} else {
+		ref = &mcp.CompleteReference{Type: "ref/prompt", Name: args[0]}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fatal("argument to complete is required")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var ret *mcp.CompleteResult
+	var err error
+	if lcl != nil {
+		ret, err = client.CompleteLocal(ctx, *lcl, ref, args)
+	} else {
+		ret, err = client.CompleteRemote(ctx, *rmt, ref, args)
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	if json {
+		printJSON(ret)
+	} else {
+		for _, val := range ret.Completion.Values {
+			fmt.Println(val)
+		}
+		if ret.Completion.HasMore {
+			if ret.Completion.Total > 0 {
+				fmt.Printf("... (%d total)\n", ret.Completion.Total)
+			} else {
+				fmt.Println("...")
+			}
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/proxy"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a configuration file of named servers, in YAML or JSON:
+//
+//	servers:
+//	  github:
+//	    url: https://api.githubcopilot.com/mcp/
+//	    bearer: env:GITHUB_TOKEN
+//	    namespace: prefix
+//	    read-only: true
+//	  files:
+//	    command: mcp-server-filesystem
+//	    args: [/home/me/src]
+//	import:
+//	  - ~/.cursor/mcp.json
+//
+// The fields of a server have the same names as the corresponding flags. Import is a list of
+// configuration files of host applications whose mcpServers are also loaded, unless a server with
+// the same name is already defined. The configuration file may also be the configuration file of
+// a host application.
+type Config struct {
+	Servers map[string]*Server `yaml:"servers" json:"servers"`
+	Import  []string           `yaml:"import,omitempty" json:"import,omitempty"`
+
+	files []string
+}
+
+type Server struct {
+	URL       string `yaml:"url,omitempty" json:"url,omitempty"`
+	Transport string `yaml:"transport,omitempty" json:"transport,omitempty"`
+
+	// APIKey, Bearer, and the values of Headers may be env:NAME, file:PATH, or exec:COMMAND;
+	// see client.Header.
+	APIKey  string            `yaml:"api-key,omitempty" json:"api-key,omitempty"`
+	Header  string            `yaml:"header,omitempty" json:"header,omitempty"`
+	Bearer  string            `yaml:"bearer,omitempty" json:"bearer,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	TLS     TLS               `yaml:"tls,omitempty" json:"tls,omitzero"`
+
+	Command string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Dir     string            `yaml:"dir,omitempty" json:"dir,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+
+	Namespace  string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Separator  string            `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Rename     map[string]string `yaml:"rename,omitempty" json:"rename,omitempty"`
+	TeeLogging bool              `yaml:"tee-logging,omitempty" json:"tee-logging,omitempty"`
+	Roots      []string          `yaml:"roots,omitempty" json:"roots,omitempty"`
+
+	AllowTools      []string `yaml:"allow-tools,omitempty" json:"allow-tools,omitempty"`
+	DenyTools       []string `yaml:"deny-tools,omitempty" json:"deny-tools,omitempty"`
+	AllowPrompts    []string `yaml:"allow-prompts,omitempty" json:"allow-prompts,omitempty"`
+	DenyPrompts     []string `yaml:"deny-prompts,omitempty" json:"deny-prompts,omitempty"`
+	AllowResources  []string `yaml:"allow-resources,omitempty" json:"allow-resources,omitempty"`
+	DenyResources   []string `yaml:"deny-resources,omitempty" json:"deny-resources,omitempty"`
+	HideDestructive bool     `yaml:"hide-destructive,omitempty" json:"hide-destructive,omitempty"`
+	ReadOnly        bool     `yaml:"read-only,omitempty" json:"read-only,omitempty"`
+}
+
+type TLS struct {
+	Cert       string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key        string `yaml:"key,omitempty" json:"key,omitempty"`
+	CA         string `yaml:"ca,omitempty" json:"ca,omitempty"`
+	ServerName string `yaml:"server-name,omitempty" json:"server-name,omitempty"`
+	MinVersion string `yaml:"min-version,omitempty" json:"min-version,omitempty"`
+}
+
+// DefaultPath returns the path of the default configuration file: config.yaml, config.yml, or
+// config.json in the gmcpt directory of the user's configuration directory, whichever exists first;
+// if none exist, config.yaml.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "gmcpt")
+
+	for _, name := range []string{"config.yaml", "config.yml", "config.json"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load loads the configuration file at path. If path is empty, the default configuration file
+// is loaded if it exists; if it does not, the configuration is empty.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		path, err = DefaultPath()
+		if err != nil {
+			return nil, fmt.Errorf("config: %s", err)
+		}
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return &Config{files: []string{path}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("config: %s", err)
+	}
+
+	cfg, err := Parse(buf, filepath.Ext(path) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %s", path, err)
+	}
+	cfg.files = []string{path}
+
+	for _, imp := range cfg.Import {
+		if rest, ok := strings.CutPrefix(imp, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("config: %s", err)
+			}
+			imp = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(imp) {
+			imp = filepath.Join(filepath.Dir(path), imp)
+		}
+
+		cfg.files = append(cfg.files, imp)
+		buf, err := os.ReadFile(imp)
+		if err != nil {
+			return nil, fmt.Errorf("config: %s", err)
+		}
+		servers, err := parseHost(buf)
+		if err == nil {
+			err = validateServers(servers)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config: %s: %s", imp, err)
+		}
+
+		if cfg.Servers == nil {
+			cfg.Servers = map[string]*Server{}
+		}
+		for name, srv := range servers {
+			if _, ok := cfg.Servers[name]; !ok {
+				cfg.Servers[name] = srv
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Parse parses a configuration in YAML, or in JSON if isJSON is true. A JSON configuration with
+// mcpServers is the configuration file of a host application.
+func Parse(buf []byte, isJSON bool) (*Config, error) {
+	var cfg Config
+	if isJSON && isHostConfig(buf) {
+		var err error
+		cfg.Servers, err = parseHost(buf)
+		if err != nil {
+			return nil, err
+		}
+	} else if isJSON {
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(buf))
+		dec.KnownFields(true)
+		err := dec.Decode(&cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+
+	err := validateServers(cfg.Servers)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Files returns the configuration file and the configuration files of host applications which
+// were loaded, or would have been loaded if they existed.
+func (cfg *Config) Files() []string {
+	return cfg.files
+}
+
+func validateServers(servers map[string]*Server) error {
+	for name, srv := range servers {
+		if name == "" || strings.Contains(name, ",") {
+			return fmt.Errorf("server name must not be empty or contain commas: %q", name)
+		} else if srv == nil {
+			return fmt.Errorf("server %s: url or command is required", name)
+		}
+		err := srv.validate()
+		if err != nil {
+			return fmt.Errorf("server %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (srv *Server) validate() error {
+	if (srv.URL == "") == (srv.Command == "") {
+		return errors.New("exactly one of url or command must be specified")
+	}
+
+	switch srv.Transport {
+	case "", "auto", client.StreamableTransport, client.SSETransport:
+	default:
+		return fmt.Errorf("transport must be auto, %s, or %s: %s", client.StreamableTransport,
+			client.SSETransport, srv.Transport)
+	}
+
+	_, err := parseNamespace(srv.Namespace)
+	return err
+}
+
+func parseNamespace(s string) (proxy.Namespace, error) {
+	switch s {
+	case "", "none":
+		return proxy.NoNamespace, nil
+	case "prefix":
+		return proxy.PrefixNamespace, nil
+	case "suffix":
+		return proxy.SuffixNamespace, nil
+	}
+	return 0, fmt.Errorf("namespace must be none, prefix, or suffix: %s", s)
+}
+
+// Remote returns the remote server to connect to.
+func (srv *Server) Remote() (client.Remote, error) {
+	tlsCfg, err := client.TLSConfig(srv.TLS.Cert, srv.TLS.Key, srv.TLS.CA, srv.TLS.ServerName,
+		srv.TLS.MinVersion)
+	if err != nil {
+		return client.Remote{}, err
+	}
+
+	rmt := client.Remote{
+		URL:    srv.URL,
+		APIKey: srv.APIKey,
+		Header: srv.Header,
+		TLS:    tlsCfg,
+	}
+	if srv.Transport != "auto" {
+		rmt.Transport = srv.Transport
+	}
+	for _, name := range slices.Sorted(maps.Keys(srv.Headers)) {
+		rmt.Headers = append(rmt.Headers, client.Header{Name: name, Source: srv.Headers[name]})
+	}
+	if srv.Bearer != "" {
+		rmt.Headers = append(rmt.Headers, client.BearerHeader(srv.Bearer))
+	}
+	return rmt, nil
+}
+
+// Local returns the local server command to run.
+func (srv *Server) Local() client.Local {
+	lcl := client.Local{
+		Command: srv.Command,
+		Args:    srv.Args,
+		Dir:     srv.Dir,
+	}
+	for _, key := range slices.Sorted(maps.Keys(srv.Env)) {
+		lcl.Env = append(lcl.Env, key+"="+srv.Env[key])
+	}
+	return lcl
+}
+
+// Upstream returns the server as an upstream of a proxy. Roots may be directories, which are
+// converted to file URIs.
+func (srv *Server) Upstream(name string) (proxy.Upstream, error) {
+	ns, err := parseNamespace(srv.Namespace)
+	if err != nil {
+		return proxy.Upstream{}, err
+	}
+
+	ups := proxy.Upstream{
+		Name:      name,
+		Namespace: ns,
+		Separator: srv.Separator,
+		Rename:    srv.Rename,
+		Filter: proxy.Filter{
+			AllowTools:      srv.AllowTools,
+			DenyTools:       srv.DenyTools,
+			AllowPrompts:    srv.AllowPrompts,
+			DenyPrompts:     srv.DenyPrompts,
+			AllowResources:  srv.AllowResources,
+			DenyResources:   srv.DenyResources,
+			HideDestructive: srv.HideDestructive,
+			ReadOnly:        srv.ReadOnly,
+		},
+		TeeLogging: srv.TeeLogging,
+	}
+
+	for _, root := range srv.Roots {
+		if !strings.Contains(root, "://") {
+			dir, err := filepath.Abs(root)
+			if err != nil {
+				return proxy.Upstream{}, err
+			}
+			root = (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()
+		}
+		ups.Roots = append(ups.Roots, root)
+	}
+
+	if srv.Command != "" {
+		lcl := srv.Local()
+		ups.Command = lcl.Command
+		ups.Args = lcl.Args
+		ups.Dir = lcl.Dir
+		ups.Env = lcl.Env
+	} else {
+		rmt, err := srv.Remote()
+		if err != nil {
+			return proxy.Upstream{}, err
+		}
+		ups.URL = rmt.URL
+		ups.APIKey = rmt.APIKey
+		ups.Header = rmt.Header
+		ups.Transport = rmt.Transport
+		ups.TLS = rmt.TLS
+		ups.Headers = rmt.Headers
+	}
+	return ups, nil
+}
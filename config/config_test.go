@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/proxy"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		s      string
+		isJSON bool
+		want   *Config
+		fail   bool
+	}{
+		{s: "", want: &Config{}},
+		{
+			s: `
+servers:
+  github:
+    url: https://example.com/mcp
+    transport: sse
+    bearer: env:GITHUB_TOKEN
+    headers:
+      X-Tenant: test
+    tls:
+      ca: ca.pem
+    namespace: prefix
+    read-only: true
+  files:
+    command: mcp-files
+    args: [-v, /tmp]
+    env:
+      DEBUG: "1"
+    allow-tools: [read_*]
+`,
+			want: &Config{
+				Servers: map[string]*Server{
+					"github": {
+						URL:       "https://example.com/mcp",
+						Transport: "sse",
+						Bearer:    "env:GITHUB_TOKEN",
+						Headers:   map[string]string{"X-Tenant": "test"},
+						TLS:       TLS{CA: "ca.pem"},
+						Namespace: "prefix",
+						ReadOnly:  true,
+					},
+					"files": {
+						Command:    "mcp-files",
+						Args:       []string{"-v", "/tmp"},
+						Env:        map[string]string{"DEBUG": "1"},
+						AllowTools: []string{"read_*"},
+					},
+				},
+			},
+		},
+		{
+			s: `{"servers": {"jira": {"url": "https://example.com/mcp", "api-key": "file:key",
+				"tls": {"server-name": "jira.internal"}}}}`,
+			isJSON: true,
+			want: &Config{
+				Servers: map[string]*Server{
+					"jira": {
+						URL:    "https://example.com/mcp",
+						APIKey: "file:key",
+						TLS:    TLS{ServerName: "jira.internal"},
+					},
+				},
+			},
+		},
+		{s: "servers:\n  a:\n    url: https://example.com/mcp\n    unknown: true\n", fail: true},
+		{s: `{"servers": {"a": {"url": "https://example.com/mcp", "unknown": true}}}`,
+			isJSON: true, fail: true},
+		{s: "servers:\n  a:\n", fail: true},
+		{s: "servers:\n  a:\n    transport: sse\n", fail: true},
+		{s: "servers:\n  a:\n    url: https://example.com/mcp\n    command: mcp\n", fail: true},
+		{s: "servers:\n  a:\n    url: https://example.com/mcp\n    transport: ws\n", fail: true},
+		{s: "servers:\n  a:\n    command: mcp\n    namespace: middle\n", fail: true},
+		{s: "servers:\n  a,b:\n    command: mcp\n", fail: true},
+	}
+
+	for _, c := range cases {
+		cfg, err := Parse([]byte(c.s), c.isJSON)
+		if c.fail {
+			if err == nil {
+				t.Errorf("Parse(%q) did not fail", c.s)
+			}
+		} else if err != nil {
+			t.Errorf("Parse(%q) failed with %s", c.s, err)
+		} else if !reflect.DeepEqual(cfg, c.want) {
+			t.Errorf("Parse(%q) got %v want %v", c.s, cfg, c.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed with %s", err)
+	} else if len(cfg.Servers) != 0 {
+		t.Errorf("Load() got %v want no servers", cfg.Servers)
+	}
+
+	path, err := DefaultPath()
+	if err != nil {
+		t.Fatalf("DefaultPath() failed with %s", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte("servers:\n  a:\n    command: mcp\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(filepath.Dir(path), "config.json"), []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := DefaultPath(); err != nil {
+		t.Errorf("DefaultPath() failed with %s", err)
+	} else if p != path {
+		t.Errorf("DefaultPath() got %s want %s", p, path)
+	}
+
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load() failed with %s", err)
+	} else if _, ok := cfg.Servers["a"]; !ok {
+		t.Errorf("Load() got %v want server a", cfg.Servers)
+	}
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	if err == nil {
+		t.Errorf("Load(missing.yaml) did not fail")
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	cases := []struct {
+		srv  Server
+		want proxy.Upstream
+		fail bool
+	}{
+		{
+			srv: Server{
+				URL:       "https://example.com/mcp",
+				Transport: "auto",
+				APIKey:    "env:KEY",
+				Header:    "X-Api-Key",
+				Bearer:    "file:token",
+				Headers:   map[string]string{"X-B": "b", "X-A": "a"},
+				Namespace: "suffix",
+				DenyTools: []string{"delete_*"},
+			},
+			want: proxy.Upstream{
+				Name:   "test",
+				URL:    "https://example.com/mcp",
+				APIKey: "env:KEY",
+				Header: "X-Api-Key",
+				Headers: []client.Header{
+					{Name: "X-A", Source: "a"},
+					{Name: "X-B", Source: "b"},
+					client.BearerHeader("file:token"),
+				},
+				Namespace: proxy.SuffixNamespace,
+				Filter:    proxy.Filter{DenyTools: []string{"delete_*"}},
+			},
+		},
+		{
+			srv: Server{
+				Command:    "mcp",
+				Args:       []string{"-v"},
+				Dir:        "/tmp",
+				Env:        map[string]string{"B": "2", "A": "1"},
+				Roots:      []string{"/src", "https://example.com/root"},
+				TeeLogging: true,
+			},
+			want: proxy.Upstream{
+				Name:       "test",
+				Command:    "mcp",
+				Args:       []string{"-v"},
+				Dir:        "/tmp",
+				Env:        []string{"A=1", "B=2"},
+				Roots:      []string{"file:///src", "https://example.com/root"},
+				TeeLogging: true,
+			},
+		},
+		{srv: Server{Command: "mcp", Namespace: "middle"}, fail: true},
+		{srv: Server{URL: "https://example.com/mcp", TLS: TLS{MinVersion: "1.1"}}, fail: true},
+	}
+
+	for _, c := range cases {
+		ups, err := c.srv.Upstream("test")
+		if c.fail {
+			if err == nil {
+				t.Errorf("Upstream(%v) did not fail", c.srv)
+			}
+		} else if err != nil {
+			t.Errorf("Upstream(%v) failed with %s", c.srv, err)
+		} else if !reflect.DeepEqual(ups, c.want) {
+			t.Errorf("Upstream(%v) got %v want %v", c.srv, ups, c.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/leftmike/gmcpt/client"
+)
+
+// hostServer is an entry in the mcpServers object of the configuration file of a host
+// application.
+type hostServer struct {
+	Type      string            `json:"type"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args"`
+	Env       map[string]string `json:"env"`
+	Cwd       string            `json:"cwd"`
+	URL       string            `json:"url"`
+	ServerURL string            `json:"serverUrl"`
+	Headers   map[string]string `json:"headers"`
+	Disabled  bool              `json:"disabled"`
+}
+
+// hostFields are the fields of a hostServer which are replaced when it is rewritten.
+var hostFields = []string{"type", "command", "args", "cwd", "url", "serverUrl", "headers"}
+
+func isHostConfig(buf []byte) bool {
+	var doc struct {
+		MCPServers json.RawMessage `json:"mcpServers"`
+	}
+	return json.Unmarshal(buf, &doc) == nil && doc.MCPServers != nil
+}
+
+// parseHost parses the mcpServers of the configuration file of a host application; disabled
+// servers are skipped.
+func parseHost(buf []byte) (map[string]*Server, error) {
+	var doc struct {
+		MCPServers map[string]hostServer `json:"mcpServers"`
+	}
+	err := json.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := map[string]*Server{}
+	for name, hs := range doc.MCPServers {
+		if hs.Disabled {
+			continue
+		}
+		srv, err := hs.expand().server()
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %s", name, err)
+		}
+		servers[name] = srv
+	}
+	return servers, nil
+}
+
+// expandVars expands the ${VAR}, ${VAR:-default}, and ${env:VAR} placeholders in s with the values
+// of environment variables; other placeholders are left alone.
+func expandVars(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(s[:start])
+		if val, ok := lookupVar(s[start+2 : end]); ok {
+			b.WriteString(val)
+		} else {
+			b.WriteString(s[start : end+1])
+		}
+		s = s[end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func lookupVar(v string) (string, bool) {
+	v = strings.TrimPrefix(v, "env:")
+	name, def, hasDef := strings.Cut(v, ":-")
+	if !isVarName(name) {
+		return "", false
+	}
+	if val, ok := os.LookupEnv(name); ok && (val != "" || !hasDef) {
+		return val, true
+	}
+	return def, true
+}
+
+func isVarName(s string) bool {
+	for i, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// expand returns the server with the placeholders in its fields expanded, as the host application
+// would.
+func (hs hostServer) expand() hostServer {
+	hs.Command = expandVars(hs.Command)
+	hs.Cwd = expandVars(hs.Cwd)
+	hs.URL = expandVars(hs.URL)
+	hs.ServerURL = expandVars(hs.ServerURL)
+	if hs.Args != nil {
+		args := make([]string, len(hs.Args))
+		for i, arg := range hs.Args {
+			args[i] = expandVars(arg)
+		}
+		hs.Args = args
+	}
+	hs.Env = expandMap(hs.Env)
+	hs.Headers = expandMap(hs.Headers)
+	return hs
+}
+
+func expandMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	em := make(map[string]string, len(m))
+	for key, val := range m {
+		em[key] = expandVars(val)
+	}
+	return em
+}
+
+func (hs hostServer) server() (*Server, error) {
+	srv := &Server{
+		URL:     hs.URL,
+		Headers: hs.Headers,
+		Command: hs.Command,
+		Args:    hs.Args,
+		Dir:     hs.Cwd,
+		Env:     hs.Env,
+	}
+	if srv.URL == "" {
+		srv.URL = hs.ServerURL
+	}
+
+	switch hs.Type {
+	case "", "stdio":
+	case "http", "streamable-http", "streamableHttp":
+		srv.Transport = client.StreamableTransport
+	case "sse":
+		srv.Transport = client.SSETransport
+	default:
+		return nil, fmt.Errorf("unknown type: %s", hs.Type)
+	}
+	return srv, nil
+}
+
+// proxyArgs returns the arguments to gmcpt to proxy the server. The values of headers are passed
+// in environment variables, which are added to env, rather than on the command line; a value which
+// is just an environment variable placeholder uses that environment variable.
+func (hs hostServer) proxyArgs(env map[string]string) ([]string, error) {
+	srv, err := hs.server()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"proxy"}
+	if srv.Command != "" {
+		if srv.Dir != "" {
+			args = append(args, "-dir", srv.Dir)
+		}
+		return append(append(args, "--", srv.Command), srv.Args...), nil
+	} else if srv.URL == "" {
+		return nil, errors.New("url or command is required")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(srv.Headers)) {
+		val := srv.Headers[name]
+		if v, ok := strings.CutPrefix(val, "${"); ok {
+			if v, ok = strings.CutSuffix(strings.TrimPrefix(v, "env:"), "}"); ok && isVarName(v) {
+				args = append(args, "-H", name+": env:"+v)
+				continue
+			}
+		}
+
+		key := "GMCPT_HEADER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if _, ok := env[key]; ok {
+			return nil, fmt.Errorf("header %s: environment variable %s is already used", name, key)
+		}
+		env[key] = val
+		args = append(args, "-H", name+": env:"+key)
+	}
+	if srv.Transport == client.SSETransport {
+		args = append(args, "-sse")
+	}
+	return append(args, "-url", srv.URL), nil
+}
+
+// RewriteHost rewrites the mcpServers of the configuration file of a host application so that
+// each server is run through gmcpt proxy, using the gmcpt executable at gmcpt. Environment
+// variables and other fields of each server are kept, and servers which are already run through
+// gmcpt proxy are left alone. Placeholders such as ${VAR} are not expanded; they are kept in the
+// args and env of the rewritten server for the host application to expand.
+func RewriteHost(buf []byte, gmcpt string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	err := json.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, err
+	} else if doc["mcpServers"] == nil {
+		return nil, errors.New("mcpServers not found")
+	}
+
+	var servers map[string]map[string]any
+	err = json.Unmarshal(doc["mcpServers"], &servers)
+	if err != nil {
+		return nil, fmt.Errorf("mcpServers: %s", err)
+	}
+
+	for name, fields := range servers {
+		buf, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		var hs hostServer
+		err = json.Unmarshal(buf, &hs)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %s", name, err)
+		}
+
+		if filepath.Base(hs.Command) == filepath.Base(gmcpt) && len(hs.Args) > 0 &&
+			hs.Args[0] == "proxy" {
+
+			continue
+		}
+
+		env := hs.Env
+		if env == nil {
+			env = map[string]string{}
+		}
+		args, err := hs.proxyArgs(env)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %s", name, err)
+		}
+		for _, fld := range hostFields {
+			delete(fields, fld)
+		}
+		if hs.Type != "" {
+			fields["type"] = "stdio"
+		}
+		fields["command"] = gmcpt
+		fields["args"] = args
+		if len(env) > 0 {
+			fields["env"] = env
+		}
+	}
+
+	doc["mcpServers"], err = json.Marshal(servers)
+	if err != nil {
+		return nil, err
+	}
+	buf, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, '\n'), nil
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHost(t *testing.T) {
+	t.Setenv("GMCPT_TEST_TOKEN", "secret")
+	t.Setenv("GMCPT_TEST_EMPTY", "")
+
+	cases := []struct {
+		s    string
+		want *Config
+		fail bool
+	}{
+		{
+			s: `{
+	"theme": "dark",
+	"mcpServers": {
+		"files": {"command": "mcp-files", "args": ["/tmp"], "env": {"DEBUG": "1"},
+			"cwd": "/src", "autoApprove": ["read"]},
+		"github": {"type": "http", "url": "https://example.com/mcp",
+			"headers": {"Authorization": "Bearer secret"}},
+		"events": {"serverUrl": "https://example.com/sse", "type": "sse"},
+		"off": {"command": "mcp-off", "disabled": true}
+	}
+}`,
+			want: &Config{
+				Servers: map[string]*Server{
+					"files": {
+						Command: "mcp-files",
+						Args:    []string{"/tmp"},
+						Env:     map[string]string{"DEBUG": "1"},
+						Dir:     "/src",
+					},
+					"github": {
+						URL:       "https://example.com/mcp",
+						Transport: "streamable-http",
+						Headers:   map[string]string{"Authorization": "Bearer secret"},
+					},
+					"events": {
+						URL:       "https://example.com/sse",
+						Transport: "sse",
+					},
+				},
+			},
+		},
+		{
+			s: `{"mcpServers": {
+	"a": {"command": "mcp", "args": ["${GMCPT_TEST_TOKEN}", "${GMCPT_TEST_EMPTY:-none}"],
+		"env": {"TOKEN": "${env:GMCPT_TEST_TOKEN}", "INPUT": "${input:token}"}},
+	"b": {"url": "https://example.com/${GMCPT_TEST_MISSING}",
+		"headers": {"Authorization": "Bearer ${GMCPT_TEST_TOKEN}"}}
+}}`,
+			want: &Config{
+				Servers: map[string]*Server{
+					"a": {
+						Command: "mcp",
+						Args:    []string{"secret", "none"},
+						Env:     map[string]string{"TOKEN": "secret", "INPUT": "${input:token}"},
+					},
+					"b": {
+						URL:     "https://example.com/",
+						Headers: map[string]string{"Authorization": "Bearer secret"},
+					},
+				},
+			},
+		},
+		{s: `{"mcpServers": {"a": {"type": "ws", "url": "wss://example.com/mcp"}}}`, fail: true},
+		{s: `{"mcpServers": {"a": {"type": "stdio"}}}`, fail: true},
+		{s: `{"mcpServers": {"a": {"command": "mcp", "url": "https://example.com/mcp"}}}`,
+			fail: true},
+	}
+
+	for _, c := range cases {
+		cfg, err := Parse([]byte(c.s), true)
+		if c.fail {
+			if err == nil {
+				t.Errorf("Parse(%q) did not fail", c.s)
+			}
+		} else if err != nil {
+			t.Errorf("Parse(%q) failed with %s", c.s, err)
+		} else if !reflect.DeepEqual(cfg, c.want) {
+			t.Errorf("Parse(%q) got %v want %v", c.s, cfg, c.want)
+		}
+	}
+}
+
+func TestLoadImport(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "host.json"),
+		[]byte(`{"mcpServers": {"a": {"command": "host-a"}, "b": {"command": "host-b"}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(path,
+		[]byte("servers:\n  a:\n    command: config-a\nimport:\n  - host.json\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load(%s) failed with %s", path, err)
+	}
+	for name, cmd := range map[string]string{"a": "config-a", "b": "host-b"} {
+		if srv, ok := cfg.Servers[name]; !ok {
+			t.Errorf("Load(%s) missing server %s", path, name)
+		} else if srv.Command != cmd {
+			t.Errorf("Load(%s) server %s got %s want %s", path, name, srv.Command, cmd)
+		}
+	}
+
+	err = os.WriteFile(path, []byte("import:\n  - missing.json\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Load(%s) did not fail", path)
+	}
+}
+
+func TestRewriteHost(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+		fail bool
+	}{
+		{
+			s: `{
+	"theme": "dark",
+	"mcpServers": {
+		"files": {"command": "mcp-files", "args": ["/tmp"], "env": {"DEBUG": "1"},
+			"cwd": "/src", "autoApprove": ["read"]},
+		"github": {"type": "http", "url": "https://example.com/mcp",
+			"headers": {"X-Api-Key": "secret"}},
+		"events": {"url": "https://example.com/sse", "type": "sse"},
+		"proxied": {"command": "/usr/bin/gmcpt", "args": ["proxy", "-url", "https://example.com"]}
+	}
+}`,
+			want: `{
+	"theme": "dark",
+	"mcpServers": {
+		"files": {"command": "/bin/gmcpt", "args": ["proxy", "-dir", "/src", "--", "mcp-files",
+			"/tmp"], "env": {"DEBUG": "1"}, "autoApprove": ["read"]},
+		"github": {"type": "stdio", "command": "/bin/gmcpt", "args": ["proxy", "-H",
+			"X-Api-Key: env:GMCPT_HEADER_X_API_KEY", "-url", "https://example.com/mcp"],
+			"env": {"GMCPT_HEADER_X_API_KEY": "secret"}},
+		"events": {"type": "stdio", "command": "/bin/gmcpt", "args": ["proxy", "-sse", "-url",
+			"https://example.com/sse"]},
+		"proxied": {"command": "/usr/bin/gmcpt", "args": ["proxy", "-url", "https://example.com"]}
+	}
+}`,
+		},
+		{
+			s: `{"mcpServers": {"a": {"url": "https://example.com/mcp",
+	"headers": {"Authorization": "${env:TOKEN}", "X-Tenant": "${TENANT:-test}"}}}}`,
+			want: `{"mcpServers": {"a": {"command": "/bin/gmcpt", "args": ["proxy", "-H",
+	"Authorization: env:TOKEN", "-H", "X-Tenant: env:GMCPT_HEADER_X_TENANT", "-url",
+	"https://example.com/mcp"], "env": {"GMCPT_HEADER_X_TENANT": "${TENANT:-test}"}}}}`,
+		},
+		{s: `{"servers": {}}`, fail: true},
+		{s: `{"mcpServers": {"a": {"type": "stdio"}}}`, fail: true},
+		{
+			s: `{"mcpServers": {"a": {"url": "https://example.com/mcp",
+	"headers": {"X-Api-Key": "a", "X_API_KEY": "b"}}}}`,
+			fail: true,
+		},
+	}
+
+	for _, c := range cases {
+		buf, err := RewriteHost([]byte(c.s), "/bin/gmcpt")
+		if c.fail {
+			if err == nil {
+				t.Errorf("RewriteHost(%q) did not fail", c.s)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("RewriteHost(%q) failed with %s", c.s, err)
+			continue
+		}
+
+		var got, want any
+		err = json.Unmarshal(buf, &got)
+		if err != nil {
+			t.Errorf("RewriteHost(%q) returned invalid JSON: %s", c.s, err)
+		}
+		err = json.Unmarshal([]byte(c.want), &want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("RewriteHost(%q) got %s want %s", c.s, buf, c.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/leftmike/gmcpt/config"
+)
+
+func configCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
+	var gmcpt string
+	var write bool
+
+	fs.StringVar(&gmcpt, "gmcpt", "", "path to gmcpt for rewritten servers (default this program)")
+	fs.BoolVar(&write, "w", false, "write result to the host configuration file instead of stdout")
+
+	args, _ := parse()
+	if len(args) == 0 || args[0] != "rewrite" {
+		fatal("usage: gmcpt config rewrite [-w] [-gmcpt path] host-config.json")
+	}
+	fs.Parse(args[1:])
+	args = fs.Args()
+	if len(args) != 1 {
+		fatal("exactly one host configuration file must be specified")
+	}
+
+	if gmcpt == "" {
+		var err error
+		gmcpt, err = os.Executable()
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+
+	buf, err := os.ReadFile(args[0])
+	if err != nil {
+		fatal(err.Error())
+	}
+	buf, err = config.RewriteHost(buf, gmcpt)
+	if err != nil {
+		fatal(args[0] + ": " + err.Error())
+	}
+
+	if write {
+		err = writeFile(args[0], buf)
+		if err != nil {
+			fatal(err.Error())
+		}
+	} else {
+		os.Stdout.Write(buf)
+	}
+}
+
+// writeFile atomically replaces the file at path with buf, keeping the mode of the file. If path
+// is a symbolic link, the file it links to is replaced.
+func writeFile(path string, buf []byte) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -1,9 +1,5 @@
 /*
 To Do:
-- prompt command to fetch a prompt
-- resource command to read a resource
-- tool command to call a tool
-
 - list command: print prompt arguments in summary and detailed views
 */
 package main
@@ -12,7 +8,14 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
 )
 
 func fatal(msg string) {
@@ -43,8 +46,202 @@ func setupLogging(log bool, logfile string) *slog.Logger {
 	return l
 }
 
+// serverFlags adds the flags for connecting to remote servers to fs, binding them to flg.
+func serverFlags(fs *flag.FlagSet, flg *config.Server) {
+	fs.StringVar(&flg.APIKey, "api-key", "",
+		"API key for remote server: key, env:NAME, file:PATH, or exec:COMMAND")
+	fs.StringVar(&flg.Header, "header", "", "header for API key (default Authorization: Bearer)")
+	fs.BoolFunc("sse", "use SSE transport", func(s string) error {
+		sse, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		flg.Transport = ""
+		if sse {
+			flg.Transport = client.SSETransport
+		}
+		return nil
+	})
+	fs.Func("H", "header to send to remote server: 'Name: value', where value may be env:NAME, "+
+		"file:PATH, or exec:COMMAND (may be repeated)",
+		func(s string) error {
+			hdr, err := client.ParseHeader(s)
+			if err != nil {
+				return err
+			}
+			if flg.Headers == nil {
+				flg.Headers = map[string]string{}
+			}
+			flg.Headers[hdr.Name] = hdr.Source
+			return nil
+		})
+	fs.StringVar(&flg.Bearer, "bearer", "",
+		"bearer token for Authorization header: token, env:NAME, file:PATH, or exec:COMMAND")
+	fs.StringVar(&flg.TLS.Cert, "tls-cert", "", "client certificate file for mutual TLS")
+	fs.StringVar(&flg.TLS.Key, "tls-key", "", "client private key file for mutual TLS")
+	fs.StringVar(&flg.TLS.CA, "tls-ca", "", "CA bundle file to verify remote servers with")
+	fs.StringVar(&flg.TLS.ServerName, "tls-server-name", "",
+		"server name to verify instead of the host in the URL")
+	fs.StringVar(&flg.TLS.MinVersion, "tls-min-version", "", "minimum TLS version: 1.2 or 1.3")
+}
+
+// applyFlags sets the fields of srv from flg for each flag which was set, so that flags override
+// the configuration file.
+func applyFlags(fs *flag.FlagSet, srv, flg *config.Server) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "api-key":
+			srv.APIKey = flg.APIKey
+		case "header":
+			srv.Header = flg.Header
+		case "sse":
+			srv.Transport = flg.Transport
+		case "H":
+			srv.Headers = mergeMaps(srv.Headers, flg.Headers)
+		case "bearer":
+			srv.Bearer = flg.Bearer
+		case "tls-cert":
+			srv.TLS.Cert = flg.TLS.Cert
+		case "tls-key":
+			srv.TLS.Key = flg.TLS.Key
+		case "tls-ca":
+			srv.TLS.CA = flg.TLS.CA
+		case "tls-server-name":
+			srv.TLS.ServerName = flg.TLS.ServerName
+		case "tls-min-version":
+			srv.TLS.MinVersion = flg.TLS.MinVersion
+		case "dir":
+			srv.Dir = flg.Dir
+		case "env":
+			srv.Env = mergeMaps(srv.Env, flg.Env)
+		case "namespace":
+			srv.Namespace = flg.Namespace
+		case "separator":
+			srv.Separator = flg.Separator
+		case "tee-logging":
+			srv.TeeLogging = flg.TeeLogging
+		case "root":
+			srv.Roots = flg.Roots
+		case "allow-tools":
+			srv.AllowTools = flg.AllowTools
+		case "deny-tools":
+			srv.DenyTools = flg.DenyTools
+		case "allow-prompts":
+			srv.AllowPrompts = flg.AllowPrompts
+		case "deny-prompts":
+			srv.DenyPrompts = flg.DenyPrompts
+		case "allow-resources":
+			srv.AllowResources = flg.AllowResources
+		case "deny-resources":
+			srv.DenyResources = flg.DenyResources
+		case "hide-destructive":
+			srv.HideDestructive = flg.HideDestructive
+		case "read-only":
+			srv.ReadOnly = flg.ReadOnly
+		}
+	})
+}
+
+func mergeMaps(m1, m2 map[string]string) map[string]string {
+	m := maps.Clone(m1)
+	if m == nil {
+		m = map[string]string{}
+	}
+	maps.Copy(m, m2)
+	return m
+}
+
+var configFile string
+
+func loadConfig() *config.Config {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fatal(err.Error())
+	}
+	return cfg
+}
+
+// configuredServers returns whether args are the names of configured servers rather than a local
+// server command; "--" always introduces a command. If the configuration file can not be loaded,
+// args are a command if it can be found, and otherwise the error loading the configuration file is
+// reported.
+func configuredServers(args []string) bool {
+	if len(args) == 0 || slices.Contains(os.Args, "--") {
+		return false
+	}
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		if len(args) == 1 {
+			if _, lerr := exec.LookPath(args[0]); lerr == nil {
+				return false
+			}
+		}
+		fatal(err.Error())
+	}
+	for _, name := range args {
+		if _, ok := cfg.Servers[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveServer returns the remote or local server named by name in the configuration file, given
+// by -url, or given by cmd; flags which were set override the configuration file.
+func resolveServer(fs *flag.FlagSet, name string, flg *config.Server,
+	cmd []string) (*client.Remote, *client.Local) {
+
+	var srv config.Server
+	if name != "" {
+		s, ok := loadConfig().Servers[name]
+		if !ok {
+			fatal(fmt.Sprintf("server not found in configuration: %s", name))
+		}
+		srv = *s
+	}
+	applyFlags(fs, &srv, flg)
+
+	if flg.URL != "" {
+		srv.URL = flg.URL
+		srv.Command = ""
+	}
+	if len(cmd) > 0 {
+		if flg.URL != "" {
+			fatal("exactly one of -url or a command must be specified")
+		}
+		srv.URL = ""
+		srv.Command = cmd[0]
+		srv.Args = cmd[1:]
+	}
+	if srv.URL == "" && srv.Command == "" {
+		fatal("a server, -url, or a command must be specified")
+	}
+
+	if srv.Command != "" {
+		lcl := srv.Local()
+		return nil, &lcl
+	}
+	rmt, err := srv.Remote()
+	if err != nil {
+		fatal(err.Error())
+	}
+	return &rmt, nil
+}
+
+// splitCommand splits args at "--" into the arguments before it and a local server command
+// after it.
+func splitCommand(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: gmcpt <proxy | list>")
+	fmt.Fprintln(os.Stderr, "usage: gmcpt <proxy | list | call | prompt | read | complete | config>")
 	os.Exit(1)
 }
 
@@ -58,6 +255,8 @@ func main() {
 	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
 	fs.BoolVar(&log, "log", false, "enable logging")
 	fs.StringVar(&logfile, "logfile", "", "log file path")
+	fs.StringVar(&configFile, "config", "",
+		"configuration file (default config.yaml in the gmcpt user configuration directory)")
 
 	parse := func() ([]string, *slog.Logger) {
 		fs.Parse(os.Args[2:])
@@ -69,6 +268,16 @@ func main() {
 		proxyCmd(fs, parse)
 	case "list":
 		listCmd(fs, parse)
+	case "call":
+		callCmd(fs, parse)
+	case "prompt":
+		promptCmd(fs, parse)
+	case "read":
+		readCmd(fs, parse)
+	case "complete":
+		completeCmd(fs, parse)
+	case "config":
+		configCmd(fs, parse)
 	default:
 		usage()
 	}
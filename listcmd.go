@@ -12,19 +12,21 @@ import (
 	"strings"
 
 	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
 )
 
 func listCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
-	var url, apiKey, header, view string
-	var sse, prompts, resources, tools, json bool
+	var server, view string
+	var prompts, resources, templates, tools, json bool
+	var flg config.Server
 
-	fs.StringVar(&url, "url", "", "remote MCP server URL")
-	fs.StringVar(&apiKey, "api-key", "", "API key for remote server")
-	fs.StringVar(&header, "header", "", "header for API key")
-	fs.BoolVar(&sse, "sse", false, "use SSE transport")
+	fs.StringVar(&server, "server", "", "name of server in configuration file")
+	fs.StringVar(&flg.URL, "url", "", "remote MCP server URL")
+	serverFlags(fs, &flg)
 	fs.StringVar(&view, "view", "brief", "view mode: brief, summary, or detailed")
 	fs.BoolVar(&prompts, "prompts", false, "list prompts")
 	fs.BoolVar(&resources, "resources", false, "list resources")
+	fs.BoolVar(&templates, "templates", false, "list resource templates")
 	fs.BoolVar(&tools, "tools", false, "list tools")
 	fs.BoolVar(&json, "json", false, "output as JSON")
 
@@ -32,9 +34,11 @@ func listCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
 	if view != "brief" && view != "summary" && view != "detailed" {
 		fatal("view must be brief, summary, or detailed")
 	}
-	if (url == "" && len(args) == 0) || (url != "" && len(args) > 0) {
-		fatal("exactly one of -url or a command must be specified")
+	if server == "" && len(args) == 1 && configuredServers(args) {
+		server = args[0]
+		args = nil
 	}
+	rmt, lcl := resolveServer(fs, server, &flg, args)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -46,46 +50,47 @@ func listCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
 	if resources {
 		lstOpts |= client.ListResources
 	}
+	if templates {
+		lstOpts |= client.ListResourceTemplates
+	}
 	if tools {
 		lstOpts |= client.ListTools
 	}
 	if lstOpts == 0 {
-		lstOpts = client.ListTools | client.ListPrompts | client.ListResources
+		lstOpts = client.ListTools | client.ListPrompts | client.ListResources |
+			client.ListResourceTemplates
 	}
 
 	var lst *client.ListOutput
 	var err error
-	if len(args) > 0 {
-		lst, err = client.ListLocal(ctx, args[0], args[1:], lstOpts)
+	if lcl != nil {
+		lst, err = client.ListLocal(ctx, *lcl, lstOpts)
 	} else {
-		lst, err = client.ListRemote(ctx, url, apiKey, header, sse, lstOpts)
+		lst, err = client.ListRemote(ctx, *rmt, lstOpts)
 	}
 	if err != nil && ctx.Err() == nil {
 		fatal(err.Error())
 	}
 
 	if json {
-		printJSONList(lst)
+		printJSON(lst)
 	} else {
+		fmt.Printf("---- Transport: %s ----\n", lst.Transport)
 		if lstOpts&client.ListPrompts != 0 {
 			printPromptList(lst, view)
 		}
 		if lstOpts&client.ListResources != 0 {
 			printResourceList(lst, view)
 		}
+		if lstOpts&client.ListResourceTemplates != 0 {
+			printResourceTemplateList(lst, view)
+		}
 		if lstOpts&client.ListTools != 0 {
 			printToolList(lst, view)
 		}
 	}
 }
 
-func printJSONList(lst *client.ListOutput) {
-	buf, err := json.MarshalIndent(lst, "", "  ")
-	if err != nil {
-		fatal(err.Error())
-	}
-	fmt.Println(string(buf))
-}
 func singleLine(s string, l int) string {
 	s, _, _ = strings.Cut(s, "\n")
 	rs := []rune(s)
@@ -186,6 +191,37 @@ func printResourceList(lst *client.ListOutput, view string) {
 	}
 }
 
+func printResourceTemplateList(lst *client.ListOutput, view string) {
+	fmt.Println("---- Resource Templates ----")
+	for _, rt := range lst.ResourceTemplates {
+		if view == "brief" {
+			if rt.Title != "" {
+				fmt.Printf("    %s (%s)\n", rt.Title, rt.Name)
+			} else {
+				fmt.Printf("    %s\n", rt.Name)
+			}
+		} else { // view == "summary" || view == "detailed"
+			if rt.Title != "" {
+				fmt.Printf("    %s\n", rt.Title)
+			}
+			fmt.Printf("    %s", rt.Name)
+			if rt.MIMEType != "" {
+				fmt.Printf(" %s", rt.MIMEType)
+			}
+			fmt.Println()
+			fmt.Printf("    %s\n", rt.URITemplate)
+			if rt.Description != "" {
+				if view == "detailed" {
+					printWithPrefix("    ", rt.Description, 5)
+				} else { // view == "summary"
+					fmt.Printf("    %s\n", singleLine(rt.Description, 70))
+				}
+			}
+			fmt.Println()
+		}
+	}
+}
+
 func schemaToArgs(sch any) ([]string, []string, []bool) {
 	schema, ok := sch.(map[string]any)
 	if !ok {
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func promptCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
+	var server string
+	var json bool
+	var flg config.Server
+
+	fs.StringVar(&server, "server", "", "name of server in configuration file")
+	fs.StringVar(&flg.URL, "url", "", "remote MCP server URL")
+	serverFlags(fs, &flg)
+	fs.BoolVar(&json, "json", false, "output as JSON")
+
+	args, _ := parse()
+	args, cmd := splitCommand(args)
+	if len(args) == 0 {
+		fatal("prompt name is required")
+	}
+	rmt, lcl := resolveServer(fs, server, &flg, cmd)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var ret *mcp.GetPromptResult
+	var err error
+	if lcl != nil {
+		ret, err = client.PromptLocal(ctx, *lcl, args[0], args[1:])
+	} else {
+		ret, err = client.PromptRemote(ctx, *rmt, args[0], args[1:])
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	if json {
+		printJSON(ret)
+	} else {
+		printPromptResult(ret)
+	}
+}
+
+func printPromptResult(ret *mcp.GetPromptResult) {
+	if ret.Description != "" {
+		fmt.Println(ret.Description)
+		fmt.Println()
+	}
+
+	for _, msg := range ret.Messages {
+		fmt.Printf("---- %s ----\n", msg.Role)
+		printContent("    ", msg.Content, 5)
+		fmt.Println()
+	}
+}
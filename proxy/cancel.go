@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type request struct {
+	ss     *mcp.ServerSession
+	ups    *upstream
+	cancel context.CancelFunc
+}
+
+// startRequest returns a context for forwarding a downstream request upstream which is cancelled
+// when the downstream request is cancelled or its session closes. Cancelling the context of an
+// upstream request sends notifications/cancelled for it to the upstream server.
+func (ups *upstream) startRequest(ctx context.Context, ss *mcp.ServerSession) (context.Context,
+	func()) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	if ss == nil {
+		return ctx, cancel
+	}
+
+	prx := ups.prx
+	prx.requestMu.Lock()
+	defer prx.requestMu.Unlock()
+
+	prx.requestID += 1
+	id := prx.requestID
+	prx.requests[id] = request{ss: ss, ups: ups, cancel: cancel}
+
+	return ctx, func() {
+		cancel()
+
+		prx.requestMu.Lock()
+		defer prx.requestMu.Unlock()
+
+		delete(prx.requests, id)
+	}
+}
+
+func (prx *Proxy) cancelRequests(ss *mcp.ServerSession) {
+	prx.requestMu.Lock()
+	defer prx.requestMu.Unlock()
+
+	for id, req := range prx.requests {
+		if req.ss == ss {
+			req.cancel()
+			delete(prx.requests, id)
+		}
+	}
+}
+
+// requestSession returns the downstream session to send a request from an upstream server to.
+// Each upstream session is shared by all of the downstream sessions, so which downstream session
+// a request is for is not known. Upstream servers make requests while handling requests of their
+// own, so it is sent to the downstream session which most recently made a request of the
+// upstream which is still in progress, and for which supports returns true; if there are no
+// requests in progress, it is sent to the downstream session if there is only one.
+func (ups *upstream) requestSession(supports func(caps *mcp.ClientCapabilities) bool) (
+	*mcp.ServerSession, error) {
+
+	prx := ups.prx
+	prx.requestMu.Lock()
+	var ss *mcp.ServerSession
+	var last int64
+	var inProgress bool
+	for id, req := range prx.requests {
+		if req.ups != ups {
+			continue
+		}
+		inProgress = true
+		if id > last && supports(clientCapabilities(req.ss)) {
+			ss = req.ss
+			last = id
+		}
+	}
+	prx.requestMu.Unlock()
+
+	if ss != nil {
+		return ss, nil
+	} else if !inProgress {
+		sessions := prx.sessions(nil)
+		if len(sessions) > 1 {
+			return nil, errors.New("more than one downstream session")
+		} else if len(sessions) == 1 && supports(clientCapabilities(sessions[0])) {
+			return sessions[0], nil
+		}
+	}
+	return nil, errors.New("no downstream session supports the request")
+}
+
+func clientCapabilities(ss *mcp.ServerSession) *mcp.ClientCapabilities {
+	if ip := ss.InitializeParams(); ip != nil && ip.Capabilities != nil {
+		return ip.Capabilities
+	}
+	return &mcp.ClientCapabilities{}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func (prx *Proxy) complete(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult,
+	error) {
+
+	ref := req.Params.Ref
+	if ref == nil {
+		return nil, fmt.Errorf("missing completion reference")
+	}
+
+	var ups *upstream
+	uref := *ref
+	prx.mu.Lock()
+	switch ref.Type {
+	case "ref/prompt":
+		ups = prx.prompts[ref.Name]
+		if ups != nil {
+			uref.Name = ups.promptNames[ref.Name]
+		}
+	case "ref/resource":
+		ups = prx.templates[ref.URI]
+		if ups == nil {
+			ups = prx.resources[ref.URI]
+		}
+		if ups != nil {
+			uref.URI = ups.upstreamURI(ref.URI)
+		}
+	}
+	prx.mu.Unlock()
+
+	if ups == nil {
+		return nil, fmt.Errorf("unknown completion reference: %s %s%s", ref.Type, ref.Name,
+			ref.URI)
+	}
+	if ups.ir.Capabilities.Completions == nil {
+		return &mcp.CompleteResult{Completion: mcp.CompletionResultDetails{Values: []string{}}},
+			nil
+	}
+
+	var ret *mcp.CompleteResult
+	err := ups.withSession(ctx,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			var err error
+			ret, err = sess.Complete(ctx, &mcp.CompleteParams{
+				Argument: req.Params.Argument,
+				Context:  req.Params.Context,
+				Ref:      &uref,
+			})
+			if err != nil {
+				slog.Error("complete", "upstream", ups.Name, "type", uref.Type, "name", uref.Name,
+					"uri", uref.URI, "argument", req.Params.Argument.Name, "error", err)
+				return err
+			}
+			return nil
+		})
+
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func supportsElicit(mode string) func(caps *mcp.ClientCapabilities) bool {
+	return func(caps *mcp.ClientCapabilities) bool {
+		ec := caps.Elicitation
+		if ec == nil {
+			return false
+		}
+		if mode == "url" {
+			return ec.URL != nil
+		}
+		return ec.Form != nil || ec.URL == nil
+	}
+}
+
+func (ups *upstream) elicit(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult,
+	error) {
+
+	mode := req.Params.Mode
+	if mode == "" && (req.Params.URL != "" || req.Params.ElicitationID != "") {
+		mode = "url"
+	}
+
+	ss, err := ups.requestSession(supportsElicit(mode))
+	if err != nil {
+		slog.Warn("elicit declined", "upstream", ups.Name, "mode", mode, "error", err)
+		return &mcp.ElicitResult{Action: "decline"}, nil
+	}
+
+	prx := ups.prx
+	id := req.Params.ElicitationID
+	if id != "" {
+		prx.elicitMu.Lock()
+		prx.elicitations[id] = ss
+		prx.elicitMu.Unlock()
+	}
+
+	ret, err := ss.Elicit(ctx, req.Params)
+	if err != nil {
+		slog.Error("elicit", "upstream", ups.Name, "mode", mode, "error", err)
+		if id != "" {
+			prx.elicitMu.Lock()
+			delete(prx.elicitations, id)
+			prx.elicitMu.Unlock()
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (ups *upstream) elicitationComplete(ctx context.Context,
+	req *mcp.ElicitationCompleteNotificationRequest) {
+
+	prx := ups.prx
+	id := req.Params.ElicitationID
+	prx.elicitMu.Lock()
+	ss, ok := prx.elicitations[id]
+	delete(prx.elicitations, id)
+	prx.elicitMu.Unlock()
+
+	if !ok {
+		slog.Warn("unknown elicitation", "upstream", ups.Name, "elicitation_id", id)
+		return
+	}
+
+	if prx.closed.Load() {
+		return
+	}
+
+	err := notifyElicitationComplete(ctx, ss, req.Params)
+	if err != nil {
+		slog.Error("elicitation complete", "upstream", ups.Name, "elicitation_id", id,
+			"error", err)
+	}
+}
+
+type elicitationCompleteKey struct{}
+
+// notifyElicitationComplete sends notifications/elicitation/complete to the client of ss, whose
+// server must use sendElicitationComplete as sending middleware.
+//
+// Server sessions have no method for sending the notification, so a progress notification is
+// sent instead, with params in its context, and sendElicitationComplete turns it into the
+// notification. This relies on two things which the SDK does not document: the context passed to
+// NotifyProgress is passed to sending middleware, and the default sending handler sends any
+// notification which clients handle. TestNotifyElicitationComplete checks both.
+func notifyElicitationComplete(ctx context.Context, ss *mcp.ServerSession,
+	params *mcp.ElicitationCompleteParams) error {
+
+	return ss.NotifyProgress(context.WithValue(ctx, elicitationCompleteKey{}, params),
+		&mcp.ProgressNotificationParams{})
+}
+
+// sendElicitationComplete is sending middleware which sends the progress notifications of
+// notifyElicitationComplete as notifications/elicitation/complete.
+func sendElicitationComplete(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		params, ok := ctx.Value(elicitationCompleteKey{}).(*mcp.ElicitationCompleteParams)
+		if ok && method == "notifications/progress" {
+			if ss, ok := req.GetSession().(*mcp.ServerSession); ok {
+				return next(ctx, "notifications/elicitation/complete",
+					&mcp.ServerRequest[*mcp.ElicitationCompleteParams]{Session: ss, Params: params})
+			}
+		}
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Filter limits which tools, prompts, and resources of an upstream are exposed. Patterns are
+// globs where * matches any sequence of characters and ? matches any single character; they are
+// matched against both the upstream and the downstream (namespaced) name or URI. If an allow list
+// is not empty, only matching items are exposed; items matching a deny list are never exposed.
+type Filter struct {
+	AllowTools     []string
+	DenyTools      []string
+	AllowPrompts   []string
+	DenyPrompts    []string
+	AllowResources []string
+	DenyResources  []string
+
+	// HideDestructive hides tools which may be destructive: tools which are not annotated with
+	// readOnlyHint, unless they are annotated with destructiveHint false, since destructiveHint
+	// defaults to true. ReadOnly hides tools which are not annotated with readOnlyHint.
+	HideDestructive bool
+	ReadOnly        bool
+}
+
+// globMatch matches s against pattern, backtracking only to the most recent * so that the time
+// taken is at most proportional to len(pattern) * len(s).
+func globMatch(pattern, s string) bool {
+	var p, i int
+	star := -1
+	var next int
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star = p
+				next = i
+				p += 1
+				continue
+			case '?':
+				_, n := utf8.DecodeRuneInString(s[i:])
+				p += 1
+				i += n
+				continue
+			default:
+				if s[i] == pattern[p] {
+					p += 1
+					i += 1
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(s[next:])
+		next += n
+		p = star + 1
+		i = next
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p += 1
+	}
+	return p == len(pattern)
+}
+
+func matchAny(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if globMatch(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func allowed(allow, deny []string, names ...string) bool {
+	if len(allow) > 0 && !matchAny(allow, names...) {
+		return false
+	}
+	return !matchAny(deny, names...)
+}
+
+func (f *Filter) allowTool(tl *mcp.Tool, name string) bool {
+	if !allowed(f.AllowTools, f.DenyTools, tl.Name, name) {
+		return false
+	}
+
+	if f.HideDestructive && (tl.Annotations == nil || (!tl.Annotations.ReadOnlyHint &&
+		(tl.Annotations.DestructiveHint == nil || *tl.Annotations.DestructiveHint))) {
+
+		return false
+	}
+	if f.ReadOnly && (tl.Annotations == nil || !tl.Annotations.ReadOnlyHint) {
+		return false
+	}
+	return true
+}
+
+func (f *Filter) allowPrompt(pr *mcp.Prompt, name string) bool {
+	return allowed(f.AllowPrompts, f.DenyPrompts, pr.Name, name)
+}
+
+func (f *Filter) allowResource(uri, duri string) bool {
+	return allowed(f.AllowResources, f.DenyResources, uri, duri)
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{pattern: "", s: "", match: true},
+		{pattern: "", s: "a", match: false},
+		{pattern: "*", s: "", match: true},
+		{pattern: "*", s: "anything/at/all", match: true},
+		{pattern: "search", s: "search", match: true},
+		{pattern: "search", s: "search2", match: false},
+		{pattern: "search*", s: "search_code", match: true},
+		{pattern: "*_delete", s: "repo_delete", match: true},
+		{pattern: "*_delete", s: "repo_delete_all", match: false},
+		{pattern: "*delete*", s: "repo_delete_all", match: true},
+		{pattern: "get_?", s: "get_x", match: true},
+		{pattern: "get_?", s: "get_", match: false},
+		{pattern: "get_?", s: "get_é", match: true},
+		{pattern: "file:///*", s: "file:///a/b/c.txt", match: true},
+		{pattern: "file:///*.txt", s: "file:///a/b/c.json", match: false},
+		{pattern: "gh__*", s: "gh__search", match: true},
+		{pattern: "a*b*c", s: "aXbYbZc", match: true},
+		{pattern: "*?", s: "é", match: true},
+		{pattern: "**", s: "", match: true},
+		{pattern: "a*a*a*a*a*a*a*a*a*a*b", s: strings.Repeat("a", 100), match: false},
+	}
+
+	for _, c := range cases {
+		if m := globMatch(c.pattern, c.s); m != c.match {
+			t.Errorf("globMatch(%q, %q) got %v want %v", c.pattern, c.s, m, c.match)
+		}
+	}
+}
+
+func TestFilterAllowTool(t *testing.T) {
+	yes := true
+	no := false
+
+	tools := map[string]*mcp.Tool{
+		"plain":    {Name: "plain"},
+		"readonly": {Name: "readonly", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}},
+		"destructive": {
+			Name:        "destructive",
+			Annotations: &mcp.ToolAnnotations{DestructiveHint: &yes},
+		},
+		"additive": {
+			Name:        "additive",
+			Annotations: &mcp.ToolAnnotations{DestructiveHint: &no},
+		},
+		"annotated": {Name: "annotated", Annotations: &mcp.ToolAnnotations{Title: "Annotated"}},
+	}
+
+	cases := []struct {
+		filter Filter
+		allow  []string
+	}{
+		{
+			filter: Filter{},
+			allow:  []string{"plain", "readonly", "destructive", "additive", "annotated"},
+		},
+		{
+			filter: Filter{AllowTools: []string{"*d*"}},
+			allow:  []string{"readonly", "destructive", "additive", "annotated"},
+		},
+		{filter: Filter{DenyTools: []string{"*d*"}}, allow: []string{"plain"}},
+		{
+			filter: Filter{AllowTools: []string{"*d*"}, DenyTools: []string{"a*"}},
+			allow:  []string{"readonly", "destructive"},
+		},
+		{filter: Filter{AllowTools: []string{"ns__plain"}}, allow: []string{"plain"}},
+		{filter: Filter{HideDestructive: true}, allow: []string{"readonly", "additive"}},
+		{filter: Filter{ReadOnly: true}, allow: []string{"readonly"}},
+	}
+
+	for _, c := range cases {
+		for name, tl := range tools {
+			want := slices.Contains(c.allow, name)
+			if got := c.filter.allowTool(tl, "ns__"+name); got != want {
+				t.Errorf("%#v.allowTool(%s) got %v want %v", c.filter, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var logLevels = []mcp.LoggingLevel{
+	"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency",
+}
+
+func slogLevel(level mcp.LoggingLevel) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "info", "notice":
+		return slog.LevelInfo
+	case "warning":
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+func (prx *Proxy) setLevelMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		ret, err := next(ctx, method, req)
+		if err != nil || method != "logging/setLevel" {
+			return ret, err
+		}
+
+		ss, ok := req.GetSession().(*mcp.ServerSession)
+		params, pok := req.GetParams().(*mcp.SetLoggingLevelParams)
+		if ok && pok {
+			prx.logMu.Lock()
+			prx.logLevels[ss] = params.Level
+			prx.logMu.Unlock()
+
+			prx.setLoggingLevels(ctx)
+		}
+		return ret, nil
+	}
+}
+
+// setLoggingLevels sets the logging level of each upstream server to the most verbose level
+// requested by any downstream session.
+func (prx *Proxy) setLoggingLevels(ctx context.Context) {
+	for _, ups := range prx.upstreamList() {
+		err := ups.withSession(ctx, ups.setLoggingLevel)
+		if err != nil {
+			slog.Error("set logging level", "upstream", ups.Name, "error", err)
+		}
+	}
+}
+
+// logLevel returns the most verbose level requested by any downstream session, or debug if
+// upstream log messages are being teed into the proxy's log.
+func (ups *upstream) logLevel() mcp.LoggingLevel {
+	if ups.settings().TeeLogging {
+		return "debug"
+	}
+
+	prx := ups.prx
+	prx.logMu.Lock()
+	defer prx.logMu.Unlock()
+
+	var level mcp.LoggingLevel
+	for _, l := range prx.logLevels {
+		if level == "" || slices.Index(logLevels, l) < slices.Index(logLevels, level) {
+			level = l
+		}
+	}
+	return level
+}
+
+func (ups *upstream) setLoggingLevel(ctx context.Context, sess *mcp.ClientSession) error {
+	if sess.InitializeResult().Capabilities.Logging == nil {
+		return nil
+	}
+
+	level := ups.logLevel()
+	if level == "" {
+		return nil
+	}
+	return sess.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: level})
+}
+
+func (ups *upstream) loggingMessage(ctx context.Context, req *mcp.LoggingMessageRequest) {
+	if ups.settings().TeeLogging {
+		slog.Log(ctx, slogLevel(req.Params.Level), "upstream log message", "upstream", ups.Name,
+			"logger", req.Params.Logger, "data", req.Params.Data)
+	}
+
+	prx := ups.prx
+	prx.mu.Lock()
+	svr := prx.svr
+	prx.mu.Unlock()
+
+	if svr == nil || prx.closed.Load() {
+		return
+	}
+
+	params := *req.Params
+	if params.Logger == "" {
+		params.Logger = ups.Name
+	}
+	for ss := range svr.Sessions() {
+		err := ss.Log(ctx, &params)
+		if err != nil {
+			slog.Error("log message", "upstream", ups.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type progress struct {
+	ss    *mcp.ServerSession
+	token any
+}
+
+// startProgress maps the progress token of a downstream request to a new token, unique across
+// all downstream sessions, to use for the upstream request.
+func (prx *Proxy) startProgress(ss *mcp.ServerSession, token any) string {
+	utoken := fmt.Sprintf("gmcpt-%d", prx.progressID.Add(1))
+
+	prx.progressMu.Lock()
+	defer prx.progressMu.Unlock()
+
+	prx.progress[utoken] = progress{ss: ss, token: token}
+	return utoken
+}
+
+// endProgress forgets the progress token after a delay: upstream notifications are handled
+// asynchronously, so the last of them may be delivered after the upstream request returns.
+func (prx *Proxy) endProgress(utoken string) {
+	time.AfterFunc(time.Second, func() {
+		prx.progressMu.Lock()
+		defer prx.progressMu.Unlock()
+
+		delete(prx.progress, utoken)
+	})
+}
+
+func (ups *upstream) progressNotification(ctx context.Context,
+	req *mcp.ProgressNotificationClientRequest) {
+
+	prx := ups.prx
+	utoken, _ := req.Params.ProgressToken.(string)
+	prx.progressMu.Lock()
+	p, ok := prx.progress[utoken]
+	prx.progressMu.Unlock()
+
+	if !ok {
+		slog.Warn("unknown progress token", "upstream", ups.Name, "token",
+			req.Params.ProgressToken)
+		return
+	}
+
+	params := *req.Params
+	params.ProgressToken = p.token
+	err := p.ss.NotifyProgress(ctx, &params)
+	if err != nil {
+		slog.Error("notify progress", "upstream", ups.Name, "error", err)
+	}
+}
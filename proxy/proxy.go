@@ -2,126 +2,526 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/leftmike/gmcpt/client"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-type Proxy struct {
+type Namespace int
+
+const (
+	NoNamespace Namespace = iota
+	PrefixNamespace
+	SuffixNamespace
+)
+
+type Upstream struct {
+	Name      string
+	URL       string
+	APIKey    string
+	Header    string
+	Transport string
+	TLS       *tls.Config
+	Headers   []client.Header
+	Command   string
+	Args      []string
+
+	// Dir is the working directory and Env are additional KEY=VALUE environment variables for
+	// Command.
+	Dir string
+	Env []string
+
+	// Namespace adds the upstream name to tool and prompt names, using Separator (default "__"),
+	// and to resource URIs as a scheme prefix: file:///x becomes name+file:///x, with characters
+	// which may not be used in a scheme replaced by - and x- added if name does not start with a
+	// letter. Rename maps upstream tool and prompt names to downstream names, and takes
+	// precedence over Namespace.
+	Namespace Namespace
+	Separator string
+	Rename    map[string]string
+
+	Filter Filter
+
+	// TeeLogging also logs messages from the upstream server to the proxy's own log.
+	TeeLogging bool
+
+	// Roots are root URIs provided to the upstream server when the downstream client provides
+	// none.
+	Roots []string
+}
+
+type upstream struct {
+	// The Namespace, Separator, Rename, Filter, TeeLogging, and Roots of Upstream may be changed
+	// by Reload, with both the proxy and mu locked; without the proxy locked, they must be read
+	// using settings.
+	Upstream
+	mu sync.Mutex
+
+	prx          *Proxy
+	scheme       string // prefix for namespaced resource URIs
 	clnt         *mcp.Client
+	roots        []*mcp.Root
 	sm           client.SessionManager
 	ir           *mcp.InitializeResult
-	toolNames    map[string]struct{}
-	promptNames  map[string]struct{}
+	toolNames    map[string]string // downstream name -> upstream name
+	promptNames  map[string]string // downstream name -> upstream name
 	resourceURIs map[string]struct{}
-	svr          *mcp.Server
+	templateURIs map[string]struct{}
+	closed       atomic.Bool
+	started      atomic.Bool
+
+	// The tools, prompts, resources, and resource templates last listed by the upstream server.
+	tools     []*mcp.Tool
+	prompts   []*mcp.Prompt
+	resources []*mcp.Resource
+	templates []*mcp.ResourceTemplate
 }
 
-func NewProxy(url, apiKey, header string, sse bool) *Proxy {
+type Proxy struct {
+	svr    *mcp.Server
+	closed atomic.Bool
+
+	reloadMu sync.Mutex
+
+	mu        sync.Mutex
+	upstreams []*upstream
+	tools     map[string]*upstream
+	prompts   map[string]*upstream
+	resources map[string]*upstream
+	templates map[string]*upstream
+
+	subMu         sync.Mutex
+	subscriptions map[string]map[*mcp.ServerSession]struct{}
+
+	logMu     sync.Mutex
+	logLevels map[*mcp.ServerSession]mcp.LoggingLevel
+
+	progressID atomic.Int64
+	progressMu sync.Mutex
+	progress   map[string]progress
+
+	requestMu sync.Mutex
+	requestID int64
+	requests  map[int64]request
+
+	// roots are the roots of the downstream client; they are guarded by mu.
+	roots []*mcp.Root
+
+	// caps are the sampling and elicitation capabilities advertised to the upstream servers,
+	// which do not connect until they are set and ready is closed; they are guarded by mu.
+	caps  *mcp.ClientCapabilities
+	ready chan struct{}
+
+	elicitMu     sync.Mutex
+	elicitations map[string]*mcp.ServerSession
+}
+
+func NewProxy(upstreams ...Upstream) *Proxy {
 	prx := &Proxy{
-		sm: client.NewSessionManager(url, apiKey, header, sse),
-	}
-
-	prx.clnt = mcp.NewClient(
-		&mcp.Implementation{Name: "gmcpt-proxy-client", Version: "0.1.0"},
-		&mcp.ClientOptions{
-			// CreateMessageHandler
-			// ElicitationHandler
-			// Capabilities
-			// ElicitationCompleteHandler
-			// ElicitationCompleteHandler
-			ToolListChangedHandler:     prx.toolListChanged,
-			PromptListChangedHandler:   prx.promptListChanged,
-			ResourceListChangedHandler: prx.resourceListChanged,
-			// ResourceUpdatedHandler
-			// LoggingMessageHandler
-			// ProgressNotificationHandler
-		})
+		tools:     map[string]*upstream{},
+		prompts:   map[string]*upstream{},
+		resources: map[string]*upstream{},
+		templates: map[string]*upstream{},
+
+		subscriptions: map[string]map[*mcp.ServerSession]struct{}{},
+		logLevels:     map[*mcp.ServerSession]mcp.LoggingLevel{},
+		progress:      map[string]progress{},
+		requests:      map[int64]request{},
+		elicitations:  map[string]*mcp.ServerSession{},
+		ready:         make(chan struct{}),
+	}
+
+	for _, u := range nameUpstreams(upstreams) {
+		prx.upstreams = append(prx.upstreams, prx.newUpstream(u))
+	}
 
 	return prx
 }
 
+// nameUpstreams names the upstreams without a name, and makes the names unique.
+func nameUpstreams(upstreams []Upstream) []Upstream {
+	var named []Upstream
+	names := map[string]struct{}{}
+	for _, u := range upstreams {
+		if u.Name == "" {
+			u.Name = upstreamName(u)
+		}
+		name := u.Name
+		for n := 2; ; n += 1 {
+			if _, ok := names[u.Name]; !ok {
+				break
+			}
+			u.Name = fmt.Sprintf("%s-%d", name, n)
+		}
+		names[u.Name] = struct{}{}
+		named = append(named, u)
+	}
+	return named
+}
+
+func (prx *Proxy) upstreamList() []*upstream {
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	return slices.Clone(prx.upstreams)
+}
+
+func upstreamName(u Upstream) string {
+	if u.Command != "" {
+		return filepath.Base(u.Command)
+	}
+	if pu, err := url.Parse(u.URL); err == nil && pu.Hostname() != "" {
+		return pu.Hostname()
+	}
+	return u.URL
+}
+
+func (ups *upstream) downstreamName(name string) string {
+	if rn, ok := ups.Rename[name]; ok {
+		return rn
+	}
+
+	sep := ups.Separator
+	if sep == "" {
+		sep = "__"
+	}
+
+	switch ups.Namespace {
+	case PrefixNamespace:
+		return ups.Name + sep + name
+	case SuffixNamespace:
+		return name + sep + ups.Name
+	}
+	return name
+}
+
+// settings returns the settings of the upstream, which Reload may change.
+func (ups *upstream) settings() Upstream {
+	ups.mu.Lock()
+	defer ups.mu.Unlock()
+
+	return ups.Upstream
+}
+
+func (ups *upstream) filter() *Filter {
+	ups.mu.Lock()
+	defer ups.mu.Unlock()
+
+	f := ups.Filter
+	return &f
+}
+
+// schemeName returns name with the characters which may not be used in a URI scheme replaced by
+// -, and x- added if it does not start with a letter.
+func schemeName(name string) string {
+	scheme := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' ||
+			r == '.') {
+			return r
+		}
+		return '-'
+	}, name)
+	if scheme == "" || !unicode.IsLetter(rune(scheme[0])) {
+		scheme = "x-" + scheme
+	}
+	return scheme
+}
+
+func (ups *upstream) downstreamURI(uri string) string {
+	if ups.settings().Namespace == NoNamespace {
+		return uri
+	}
+	return ups.scheme + "+" + uri
+}
+
+func (ups *upstream) upstreamURI(uri string) string {
+	if ups.settings().Namespace == NoNamespace {
+		return uri
+	}
+	uri, _ = strings.CutPrefix(uri, ups.scheme+"+")
+	return uri
+}
+
+// downstreamContent changes the URIs of the resource links and embedded resources in content to
+// downstream URIs.
+func (ups *upstream) downstreamContent(content []mcp.Content) {
+	for _, c := range content {
+		switch c := c.(type) {
+		case *mcp.ResourceLink:
+			c.URI = ups.downstreamURI(c.URI)
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil {
+				c.Resource.URI = ups.downstreamURI(c.Resource.URI)
+			}
+		}
+	}
+}
+
+func (prx *Proxy) newUpstream(u Upstream) *upstream {
+	ups := &upstream{
+		Upstream: u,
+		prx:      prx,
+		scheme:   schemeName(u.Name),
+	}
+
+	if u.Command != "" {
+		ups.sm = client.NewLocalSessionManager(u.Command, u.Args)
+		ups.sm.CommandOptions(u.Dir, u.Env, &stderrLogger{upstream: ups.Name})
+		ups.sm.RestartOnExit()
+	} else {
+		ups.sm = client.NewSessionManager(client.Remote{
+			URL:       u.URL,
+			APIKey:    u.APIKey,
+			Header:    u.Header,
+			Transport: u.Transport,
+			TLS:       u.TLS,
+			Headers:   u.Headers,
+		})
+	}
+	ups.sm.OnConnect(ups.connected)
+
+	prx.mu.Lock()
+	ups.roots = prx.roots
+	prx.mu.Unlock()
+	if len(ups.roots) == 0 {
+		ups.roots = fixedRoots(u.Roots)
+	}
+	return ups
+}
+
+// setClientCapabilities sets the sampling and elicitation capabilities advertised to the upstream
+// servers, and lets them connect; it returns false if they were already set.
+func (prx *Proxy) setClientCapabilities(caps *mcp.ClientCapabilities) bool {
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	select {
+	case <-prx.ready:
+		return false
+	default:
+	}
+
+	if caps == nil {
+		caps = &mcp.ClientCapabilities{}
+	}
+	prx.caps = caps
+	close(prx.ready)
+	return true
+}
+
+// client returns the client for the upstream server; it is created the first time it is used,
+// once the capabilities to advertise to the upstream server are known.
+func (ups *upstream) client() *mcp.Client {
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if ups.clnt == nil {
+		ups.clnt = ups.newClient(prx.caps)
+	}
+	return ups.clnt
+}
+
+// newClient returns a client for the upstream server which provides the current roots and
+// advertises sampling and elicitation if they are in caps. The proxy must be locked.
+func (ups *upstream) newClient(caps *mcp.ClientCapabilities) *mcp.Client {
+	opts := &mcp.ClientOptions{
+		Capabilities: &mcp.ClientCapabilities{
+			RootsV2: &mcp.RootCapabilities{ListChanged: true},
+		},
+		ToolListChangedHandler:      ups.toolListChanged,
+		PromptListChangedHandler:    ups.promptListChanged,
+		ResourceListChangedHandler:  ups.resourceListChanged,
+		ResourceUpdatedHandler:      ups.resourceUpdated,
+		LoggingMessageHandler:       ups.loggingMessage,
+		ProgressNotificationHandler: ups.progressNotification,
+	}
+	if caps.Sampling != nil {
+		opts.Capabilities.Sampling = &mcp.SamplingCapabilities{}
+		opts.CreateMessageHandler = ups.createMessage
+	}
+	if ec := caps.Elicitation; ec != nil {
+		opts.Capabilities.Elicitation = &mcp.ElicitationCapabilities{Form: ec.Form, URL: ec.URL}
+		opts.ElicitationHandler = ups.elicit
+		opts.ElicitationCompleteHandler = ups.elicitationComplete
+	}
+
+	clnt := mcp.NewClient(&mcp.Implementation{Name: "gmcpt-proxy-client", Version: "0.1.0"},
+		opts)
+	clnt.AddRoots(ups.roots...)
+	return clnt
+}
+
 func (prx *Proxy) Close() {
-	prx.sm.Close()
-	for sess := range prx.svr.Sessions() {
-		sess.Close()
+	prx.closed.Store(true)
+	prx.setClientCapabilities(nil)
+	for _, ups := range prx.upstreamList() {
+		ups.sm.Shutdown()
+	}
+	if prx.svr != nil {
+		for sess := range prx.svr.Sessions() {
+			sess.Close()
+		}
 	}
 }
 
-func (prx *Proxy) withSession(ctx context.Context,
+func (ups *upstream) withSession(ctx context.Context,
 	with func(ctx context.Context, sess *mcp.ClientSession) error) error {
 
-	return prx.sm.WithSession(ctx, prx.clnt, with)
+	select {
+	case <-ups.prx.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return ups.sm.WithSession(ctx, ups.client(), with)
 }
 
-func (prx *Proxy) toolListChanged(ctx context.Context, req *mcp.ToolListChangedRequest) {
-	slog.Info("tool list changed")
+// isClosed returns true if the proxy has been closed or the upstream has been removed from it.
+func (ups *upstream) isClosed() bool {
+	return ups.prx.closed.Load() || ups.closed.Load()
+}
 
-	err := prx.withSession(ctx, prx.updateTools)
-	if err != nil {
-		slog.Error("update tools", "error", err.Error())
-		panic(fmt.Sprintf("unabled to update tools after tool list changed notification: %s", err))
+// toolListChanged updates the tools of the upstream; if they can not be listed, the tools it last
+// listed are kept.
+func (ups *upstream) toolListChanged(ctx context.Context, req *mcp.ToolListChangedRequest) {
+	slog.Info("tool list changed", "upstream", ups.Name)
+
+	err := ups.withSession(ctx, ups.updateTools)
+	if err != nil && !ups.isClosed() {
+		slog.Error("update tools", "upstream", ups.Name, "error", err.Error())
 	}
 }
 
-func (prx *Proxy) updateTools(ctx context.Context, sess *mcp.ClientSession) error {
+func (ups *upstream) updateTools(ctx context.Context, sess *mcp.ClientSession) error {
 	ret, err := sess.ListTools(ctx, nil)
 	if err != nil {
-		slog.Error("list tools", "error", err.Error())
+		slog.Error("list tools", "upstream", ups.Name, "error", err.Error())
 		return err
 	}
 
-	newNames := map[string]struct{}{}
-	for _, tl := range ret.Tools {
-		newNames[tl.Name] = struct{}{}
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if prx.svr == nil || ups.closed.Load() {
+		// The initial update happens after the server is created, and removed upstreams are
+		// not updated.
+		return nil
+	}
+
+	ups.tools = ret.Tools
+	if ups.registerTools() {
+		prx.registerOthers(ups)
+	}
+	return nil
+}
+
+// registerTools adds and removes the downstream tools of the upstream to match the tools it last
+// listed; it returns true if any were removed. Tools with the same name as a tool of another
+// upstream are skipped. The proxy must be locked.
+func (ups *upstream) registerTools() bool {
+	prx := ups.prx
+	newNames := map[string]string{}
+	var add []*mcp.Tool
+	for _, tl := range ups.tools {
+		name := ups.downstreamName(tl.Name)
+		if !ups.Filter.allowTool(tl, name) {
+			slog.Info("filtered tool", "upstream", ups.Name, "name", name)
+			continue
+		}
+		if owner, ok := prx.tools[name]; ok && owner != ups {
+			slog.Warn("duplicate tool", "upstream", ups.Name, "name", name, "owner", owner.Name)
+			continue
+		} else if un, ok := newNames[name]; ok {
+			slog.Warn("duplicate tool", "upstream", ups.Name, "name", name, "tool", tl.Name,
+				"renamed", un)
+			continue
+		}
+
+		newNames[name] = tl.Name
+		if un, ok := ups.toolNames[name]; !ok || un != tl.Name {
+			add = append(add, tl)
+		}
 	}
 
 	var remove []string
-	for name := range prx.toolNames {
+	for name := range ups.toolNames {
 		if _, ok := newNames[name]; !ok {
 			remove = append(remove, name)
+			delete(prx.tools, name)
 		}
 	}
 	if len(remove) > 0 {
 		prx.svr.RemoveTools(remove...)
 	}
 
-	for _, tl := range ret.Tools {
-		if _, ok := prx.toolNames[tl.Name]; ok {
-			continue
-		}
-		prx.svr.AddTool(tl, prx.toolHandler(tl.Name))
+	for _, tl := range add {
+		dtl := *tl
+		dtl.Name = ups.downstreamName(tl.Name)
+		prx.tools[dtl.Name] = ups
+		prx.svr.AddTool(&dtl, ups.toolHandler(tl))
 	}
 
-	prx.toolNames = newNames
-	return nil
+	ups.toolNames = newNames
+	return len(remove) > 0
 }
 
-func (prx *Proxy) toolHandler(name string) mcp.ToolHandler {
+func (ups *upstream) toolHandler(tl *mcp.Tool) mcp.ToolHandler {
+	name := tl.Name
 	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !ups.filter().allowTool(tl, req.Params.Name) {
+			slog.Warn("call filtered tool", "upstream", ups.Name, "name", req.Params.Name)
+			return nil, fmt.Errorf("tool not allowed: %s", req.Params.Name)
+		}
+
+		ctx, done := ups.startRequest(ctx, req.Session)
+		defer done()
+
 		var ret *mcp.CallToolResult
-		err := prx.withSession(ctx,
+		err := ups.withSession(ctx,
 			func(ctx context.Context, sess *mcp.ClientSession) error {
 				var args map[string]any
 				if len(req.Params.Arguments) > 0 {
 					err := json.Unmarshal(req.Params.Arguments, &args)
 					if err != nil {
-						slog.Error("json unmarshal", "name", name, "args", req.Params.Arguments,
-							"error", err.Error())
+						slog.Error("json unmarshal", "upstream", ups.Name, "name", name,
+							"args", req.Params.Arguments, "error", err.Error())
 						return err
 					}
 				}
 
-				slog.Info("call tool", "name", name, "args", args)
+				slog.Info("call tool", "upstream", ups.Name, "name", name, "args", args)
+
+				params := &mcp.CallToolParams{Name: name, Arguments: args}
+				if token := req.Params.GetProgressToken(); token != nil {
+					utoken := ups.prx.startProgress(req.Session, token)
+					defer ups.prx.endProgress(utoken)
+					params.Meta = mcp.Meta{}
+					params.SetProgressToken(utoken)
+				}
 
 				var err error
-				ret, err = sess.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+				ret, err = sess.CallTool(ctx, params)
 				if err != nil {
-					slog.Error("call tool", "name", name, "args", args, "error", err)
+					slog.Error("call tool", "upstream", ups.Name, "name", name, "args", args,
+						"error", err)
 					return err
 				}
 				return nil
@@ -130,58 +530,107 @@ func (prx *Proxy) toolHandler(name string) mcp.ToolHandler {
 		if err != nil {
 			return nil, err
 		}
+		ups.downstreamContent(ret.Content)
 		return ret, nil
 	}
 }
 
-func (prx *Proxy) promptListChanged(ctx context.Context, req *mcp.PromptListChangedRequest) {
-	slog.Info("prompt list changed")
+// promptListChanged is like toolListChanged, but for prompts.
+func (ups *upstream) promptListChanged(ctx context.Context, req *mcp.PromptListChangedRequest) {
+	slog.Info("prompt list changed", "upstream", ups.Name)
 
-	err := prx.withSession(ctx, prx.updatePrompts)
-	if err != nil {
-		slog.Error("update prompts", "error", err)
-		panic(fmt.Sprintf("unabled to update prompts after prompt list changed notification: %s",
-			err))
+	err := ups.withSession(ctx, ups.updatePrompts)
+	if err != nil && !ups.isClosed() {
+		slog.Error("update prompts", "upstream", ups.Name, "error", err)
 	}
 }
 
-func (prx *Proxy) updatePrompts(ctx context.Context, sess *mcp.ClientSession) error {
+func (ups *upstream) updatePrompts(ctx context.Context, sess *mcp.ClientSession) error {
 	ret, err := sess.ListPrompts(ctx, nil)
 	if err != nil {
-		slog.Error("list prompts", "error", err)
+		slog.Error("list prompts", "upstream", ups.Name, "error", err)
 		return err
 	}
 
-	newNames := map[string]struct{}{}
-	for _, pr := range ret.Prompts {
-		newNames[pr.Name] = struct{}{}
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if prx.svr == nil || ups.closed.Load() {
+		// The initial update happens after the server is created, and removed upstreams are
+		// not updated.
+		return nil
+	}
+
+	ups.prompts = ret.Prompts
+	if ups.registerPrompts() {
+		prx.registerOthers(ups)
+	}
+	return nil
+}
+
+// registerPrompts is like registerTools, but for prompts.
+func (ups *upstream) registerPrompts() bool {
+	prx := ups.prx
+	newNames := map[string]string{}
+	var add []*mcp.Prompt
+	for _, pr := range ups.prompts {
+		name := ups.downstreamName(pr.Name)
+		if !ups.Filter.allowPrompt(pr, name) {
+			slog.Info("filtered prompt", "upstream", ups.Name, "name", name)
+			continue
+		}
+		if owner, ok := prx.prompts[name]; ok && owner != ups {
+			slog.Warn("duplicate prompt", "upstream", ups.Name, "name", name,
+				"owner", owner.Name)
+			continue
+		} else if un, ok := newNames[name]; ok {
+			slog.Warn("duplicate prompt", "upstream", ups.Name, "name", name, "prompt", pr.Name,
+				"renamed", un)
+			continue
+		}
+
+		newNames[name] = pr.Name
+		if un, ok := ups.promptNames[name]; !ok || un != pr.Name {
+			add = append(add, pr)
+		}
 	}
 
 	var remove []string
-	for name := range prx.promptNames {
+	for name := range ups.promptNames {
 		if _, ok := newNames[name]; !ok {
 			remove = append(remove, name)
+			delete(prx.prompts, name)
 		}
 	}
 	if len(remove) > 0 {
 		prx.svr.RemovePrompts(remove...)
 	}
 
-	for _, pr := range ret.Prompts {
-		if _, ok := prx.promptNames[pr.Name]; ok {
-			continue
-		}
-		prx.svr.AddPrompt(pr, prx.promptHandler(pr.Name))
+	for _, pr := range add {
+		dpr := *pr
+		dpr.Name = ups.downstreamName(pr.Name)
+		prx.prompts[dpr.Name] = ups
+		prx.svr.AddPrompt(&dpr, ups.promptHandler(pr))
 	}
 
-	prx.promptNames = newNames
-	return nil
+	ups.promptNames = newNames
+	return len(remove) > 0
 }
 
-func (prx *Proxy) promptHandler(name string) mcp.PromptHandler {
+func (ups *upstream) promptHandler(pr *mcp.Prompt) mcp.PromptHandler {
+	name := pr.Name
 	return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		if !ups.filter().allowPrompt(pr, req.Params.Name) {
+			slog.Warn("get filtered prompt", "upstream", ups.Name, "name", req.Params.Name)
+			return nil, fmt.Errorf("prompt not allowed: %s", req.Params.Name)
+		}
+
+		ctx, done := ups.startRequest(ctx, req.Session)
+		defer done()
+
 		var ret *mcp.GetPromptResult
-		err := prx.withSession(ctx,
+		err := ups.withSession(ctx,
 			func(ctx context.Context, sess *mcp.ClientSession) error {
 				var err error
 				ret, err = sess.GetPrompt(ctx, &mcp.GetPromptParams{
@@ -189,8 +638,8 @@ func (prx *Proxy) promptHandler(name string) mcp.PromptHandler {
 					Arguments: req.Params.Arguments,
 				})
 				if err != nil {
-					slog.Error("get prompt", "name", name, "args", req.Params.Arguments,
-						"error", err)
+					slog.Error("get prompt", "upstream", ups.Name, "name", name,
+						"args", req.Params.Arguments, "error", err)
 					return err
 				}
 				return nil
@@ -199,65 +648,204 @@ func (prx *Proxy) promptHandler(name string) mcp.PromptHandler {
 		if err != nil {
 			return nil, err
 		}
+		for _, msg := range ret.Messages {
+			ups.downstreamContent([]mcp.Content{msg.Content})
+		}
 		return ret, nil
 	}
 }
 
-func (prx *Proxy) resourceListChanged(ctx context.Context, req *mcp.ResourceListChangedRequest) {
-	slog.Info("resource list changed")
+// resourceListChanged is like toolListChanged, but for resources and resource templates.
+func (ups *upstream) resourceListChanged(ctx context.Context,
+	req *mcp.ResourceListChangedRequest) {
 
-	err := prx.withSession(ctx, prx.updateResources)
-	if err != nil {
-		slog.Error("update resources", "error", err)
-		panic(fmt.Sprintf(
-			"unabled to update resources after resource list changed notification: %s", err))
+	slog.Info("resource list changed", "upstream", ups.Name)
+
+	err := ups.withSession(ctx, ups.updateResources)
+	if err != nil && !ups.isClosed() {
+		slog.Error("update resources", "upstream", ups.Name, "error", err)
+	}
+
+	err = ups.withSession(ctx, ups.updateResourceTemplates)
+	if err != nil && !ups.isClosed() {
+		slog.Error("update resource templates", "upstream", ups.Name, "error", err)
 	}
 }
 
-func (prx *Proxy) updateResources(ctx context.Context, sess *mcp.ClientSession) error {
+func (ups *upstream) updateResources(ctx context.Context, sess *mcp.ClientSession) error {
 	ret, err := sess.ListResources(ctx, nil)
 	if err != nil {
-		slog.Error("list resources", "error", err)
+		slog.Error("list resources", "upstream", ups.Name, "error", err)
 		return err
 	}
 
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if prx.svr == nil || ups.closed.Load() {
+		// The initial update happens after the server is created, and removed upstreams are
+		// not updated.
+		return nil
+	}
+
+	ups.resources = ret.Resources
+	if ups.registerResources() {
+		prx.registerOthers(ups)
+	}
+	return nil
+}
+
+// registerResources is like registerTools, but for resources.
+func (ups *upstream) registerResources() bool {
+	prx := ups.prx
 	newURIs := map[string]struct{}{}
-	for _, rs := range ret.Resources {
-		newURIs[rs.URI] = struct{}{}
+	var add []*mcp.Resource
+	for _, rs := range ups.resources {
+		uri := ups.downstreamURI(rs.URI)
+		if !ups.Filter.allowResource(rs.URI, uri) {
+			slog.Info("filtered resource", "upstream", ups.Name, "uri", uri)
+			continue
+		}
+		if owner, ok := prx.resources[uri]; ok && owner != ups {
+			slog.Warn("duplicate resource", "upstream", ups.Name, "uri", uri,
+				"owner", owner.Name)
+			continue
+		}
+
+		newURIs[uri] = struct{}{}
+		if _, ok := ups.resourceURIs[uri]; !ok {
+			add = append(add, rs)
+		}
 	}
 
 	var remove []string
-	for uri := range prx.resourceURIs {
+	for uri := range ups.resourceURIs {
 		if _, ok := newURIs[uri]; !ok {
 			remove = append(remove, uri)
+			delete(prx.resources, uri)
 		}
 	}
 	if len(remove) > 0 {
 		prx.svr.RemoveResources(remove...)
 	}
 
-	for _, rs := range ret.Resources {
-		if _, ok := prx.resourceURIs[rs.URI]; ok {
+	for _, rs := range add {
+		drs := *rs
+		drs.URI = ups.downstreamURI(rs.URI)
+		prx.resources[drs.URI] = ups
+		prx.svr.AddResource(&drs, ups.resourceHandler())
+	}
+
+	ups.resourceURIs = newURIs
+	return len(remove) > 0
+}
+
+func (ups *upstream) updateResourceTemplates(ctx context.Context, sess *mcp.ClientSession) error {
+	ret, err := sess.ListResourceTemplates(ctx, nil)
+	if err != nil {
+		// Not all servers which support resources support resource templates.
+		slog.Warn("list resource templates", "upstream", ups.Name, "error", err)
+		ret = &mcp.ListResourceTemplatesResult{}
+	}
+
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if prx.svr == nil || ups.closed.Load() {
+		// The initial update happens after the server is created, and removed upstreams are
+		// not updated.
+		return nil
+	}
+
+	ups.templates = ret.ResourceTemplates
+	if ups.registerResourceTemplates() {
+		prx.registerOthers(ups)
+	}
+	return nil
+}
+
+// registerResourceTemplates is like registerTools, but for resource templates.
+func (ups *upstream) registerResourceTemplates() bool {
+	prx := ups.prx
+	newURIs := map[string]struct{}{}
+	var add []*mcp.ResourceTemplate
+	for _, rt := range ups.templates {
+		uri := ups.downstreamURI(rt.URITemplate)
+		if !ups.Filter.allowResource(rt.URITemplate, uri) {
+			slog.Info("filtered resource template", "upstream", ups.Name, "uri_template", uri)
+			continue
+		}
+		if owner, ok := prx.templates[uri]; ok && owner != ups {
+			slog.Warn("duplicate resource template", "upstream", ups.Name, "uri_template", uri,
+				"owner", owner.Name)
 			continue
 		}
-		prx.svr.AddResource(rs, prx.resourceHandler(rs.URI))
+
+		newURIs[uri] = struct{}{}
+		if _, ok := ups.templateURIs[uri]; !ok {
+			add = append(add, rt)
+		}
 	}
 
-	prx.resourceURIs = newURIs
-	return nil
+	var remove []string
+	for uri := range ups.templateURIs {
+		if _, ok := newURIs[uri]; !ok {
+			remove = append(remove, uri)
+			delete(prx.templates, uri)
+		}
+	}
+	if len(remove) > 0 {
+		prx.svr.RemoveResourceTemplates(remove...)
+	}
+
+	for _, rt := range add {
+		drt := *rt
+		drt.URITemplate = ups.downstreamURI(rt.URITemplate)
+		prx.templates[drt.URITemplate] = ups
+		prx.svr.AddResourceTemplate(&drt, ups.resourceHandler())
+	}
+
+	ups.templateURIs = newURIs
+	return len(remove) > 0
 }
 
-func (prx *Proxy) resourceHandler(uri string) mcp.ResourceHandler {
+// registerOthers registers the tools, prompts, resources, and resource templates of the upstreams
+// other than ups, which removed some of its own: those which were skipped because they had the
+// same names may now be added. The proxy must be locked.
+func (prx *Proxy) registerOthers(ups *upstream) {
+	for _, other := range prx.upstreams {
+		if other == ups || other.closed.Load() {
+			continue
+		}
+		other.registerTools()
+		other.registerPrompts()
+		other.registerResources()
+		other.registerResourceTemplates()
+	}
+}
+
+func (ups *upstream) resourceHandler() mcp.ResourceHandler {
 	return func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		uri := ups.upstreamURI(req.Params.URI)
+		if !ups.filter().allowResource(uri, req.Params.URI) {
+			slog.Warn("read filtered resource", "upstream", ups.Name, "uri", req.Params.URI)
+			return nil, mcp.ResourceNotFoundError(req.Params.URI)
+		}
+
+		ctx, done := ups.startRequest(ctx, req.Session)
+		defer done()
+
 		var ret *mcp.ReadResourceResult
-		err := prx.withSession(ctx,
+		err := ups.withSession(ctx,
 			func(ctx context.Context, sess *mcp.ClientSession) error {
 				var err error
 				ret, err = sess.ReadResource(ctx, &mcp.ReadResourceParams{
 					URI: uri,
 				})
 				if err != nil {
-					slog.Error("read resource", "uri", uri, "error", err)
+					slog.Error("read resource", "upstream", ups.Name, "uri", uri, "error", err)
 					return err
 				}
 				return nil
@@ -266,19 +854,61 @@ func (prx *Proxy) resourceHandler(uri string) mcp.ResourceHandler {
 		if err != nil {
 			return nil, err
 		}
+		for _, rc := range ret.Contents {
+			rc.URI = ups.downstreamURI(rc.URI)
+		}
 		return ret, nil
 	}
 }
 
-func (prx *Proxy) initializeResult(ctx context.Context, sess *mcp.ClientSession) error {
+// connected restores the logging level and resubscribes to the upstream resources which have
+// downstream subscribers after the upstream session has been (re)established.
+func (ups *upstream) connected(ctx context.Context, sess *mcp.ClientSession) error {
+	err := ups.setLoggingLevel(ctx, sess)
+	if err != nil {
+		slog.Error("set logging level", "upstream", ups.Name, "error", err)
+	}
+
+	if ups.started.Load() {
+		// The upstream was restarted or reconnected, so its tools, prompts, and resources may
+		// have changed.
+		err = ups.update(ctx, sess)
+		if err != nil {
+			slog.Error("update after reconnect", "upstream", ups.Name, "error", err)
+		}
+	}
+
+	prx := ups.prx
+	prx.subMu.Lock()
+	var uris []string
+	for uri := range prx.subscriptions {
+		uris = append(uris, uri)
+	}
+	prx.subMu.Unlock()
+
+	for _, uri := range uris {
+		if prx.resourceOwner(uri) != ups {
+			continue
+		}
+
+		err := sess.Subscribe(ctx, &mcp.SubscribeParams{URI: ups.upstreamURI(uri)})
+		if err != nil {
+			slog.Error("resubscribe", "upstream", ups.Name, "uri", uri, "error", err)
+		}
+	}
+	return nil
+}
+
+func (ups *upstream) initializeResult(ctx context.Context, sess *mcp.ClientSession) error {
 	ir := sess.InitializeResult()
 
-	slog.Info("initialize result", "capabilities", ir.Capabilities,
-		"instructions", ir.Instructions, "protocol_version", ir.ProtocolVersion,
+	slog.Info("initialize result", "upstream", ups.Name, "transport", ups.sm.Transport(),
+		"capabilities", ir.Capabilities, "instructions", ir.Instructions,
+		"protocol_version", ir.ProtocolVersion,
 		"server_name", ir.ServerInfo.Name, "server_title", ir.ServerInfo.Title,
 		"server_version", ir.ServerInfo.Version, "server_website", ir.ServerInfo.WebsiteURL)
 
-	prx.ir = ir
+	ups.ir = ir
 	return nil
 }
 
@@ -300,41 +930,305 @@ func (prx *Proxy) Run(ctx context.Context, l *slog.Logger, logProto string) erro
 	return prx.run(ctx, l, t)
 }
 
+// run serves the proxy to a single downstream client over t. The upstream servers are started
+// when the downstream client initializes, so that only the sampling and elicitation capabilities
+// which it has are advertised to them.
 func (prx *Proxy) run(ctx context.Context, l *slog.Logger, t mcp.Transport) error {
-	err := prx.withSession(ctx, prx.initializeResult)
+	svr := prx.server(l)
+	svr.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(rctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if params, ok := req.GetParams().(*mcp.InitializeParams); ok {
+				caps := &mcp.ClientCapabilities{}
+				if params.Capabilities != nil {
+					caps.Sampling = params.Capabilities.Sampling
+					caps.Elicitation = params.Capabilities.Elicitation
+				}
+				err := prx.start(ctx, caps)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return next(rctx, method, req)
+		}
+	})
+	return svr.Run(ctx, t)
+}
+
+// Listen serves the proxy over Streamable HTTP at /mcp on addr, and, if sse is true, over SSE at
+// /sse, until ctx is done; requests in progress are then given some time to finish. If addr has
+// no host, the proxy listens on 127.0.0.1. When listening on a loopback address, requests must be
+// for a loopback host, so that web pages can not use DNS rebinding to reach the proxy.
+func (prx *Proxy) Listen(ctx context.Context, l *slog.Logger, addr string, sse bool) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+		addr = net.JoinHostPort(host, port)
+	}
+
+	// Each upstream session is shared by the downstream sessions, which are not known when it
+	// connects, so sampling and elicitation are always advertised to the upstream servers; see
+	// requestSession.
+	svr := prx.server(l)
+	err = prx.start(ctx, &mcp.ClientCapabilities{
+		Sampling: &mcp.SamplingCapabilities{},
+		Elicitation: &mcp.ElicitationCapabilities{
+			Form: &mcp.FormElicitationCapabilities{},
+			URL:  &mcp.URLElicitationCapabilities{},
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	prx.svr = mcp.NewServer(
-		&mcp.Implementation{Name: "gmcpt-proxy-server", Version: "0.1.0"},
+	getServer := func(req *http.Request) *mcp.Server { return svr }
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", mcp.NewStreamableHTTPHandler(getServer,
+		&mcp.StreamableHTTPOptions{Logger: l, SessionTimeout: 30 * time.Minute}))
+	if sse {
+		mux.Handle("/sse", mcp.NewSSEHandler(getServer, nil))
+	}
+
+	hsvr := &http.Server{
+		Addr:    addr,
+		Handler: checkHost(mux, isLoopback(host)),
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithoutCancel(ctx)
+		},
+	}
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := hsvr.Shutdown(sctx)
+		if err != nil {
+			slog.Warn("shutdown", "addr", addr, "error", err)
+			hsvr.Close()
+		}
+	}()
+
+	slog.Info("listening", "addr", addr, "sse", sse)
+	err = hsvr.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdown
+		return ctx.Err()
+	}
+	return err
+}
+
+const shutdownTimeout = 10 * time.Second
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkHost rejects requests whose Host is not a loopback host, if loopback is true, and requests
+// from web pages whose Origin is not the same: a loopback host if loopback is true, otherwise
+// the Host of the request.
+func checkHost(h http.Handler, loopback bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHost(r, loopback) {
+			slog.Warn("request rejected", "host", r.Host, "origin", r.Header.Get("Origin"))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func allowedHost(r *http.Request, loopback bool) bool {
+	if loopback && !isLoopback((&url.URL{Host: r.Host}).Hostname()) {
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not from a web page.
+		return true
+	}
+	ou, err := url.Parse(origin)
+	if err != nil {
+		return false
+	} else if loopback {
+		return isLoopback(ou.Hostname())
+	}
+	return strings.EqualFold(ou.Host, r.Host)
+}
+
+func (prx *Proxy) server(l *slog.Logger) *mcp.Server {
+	svr := mcp.NewServer(&mcp.Implementation{Name: "gmcpt-proxy-server", Version: "0.1.0"},
 		&mcp.ServerOptions{
-			Logger: l,
+			Logger:                  l,
+			InitializedHandler:      prx.initialized,
+			RootsListChangedHandler: prx.rootsListChanged,
+			SubscribeHandler:        prx.subscribe,
+			UnsubscribeHandler:      prx.unsubscribe,
+			CompletionHandler:       prx.complete,
 		})
+	prx.mu.Lock()
+	prx.svr = svr
+	prx.mu.Unlock()
+	svr.AddReceivingMiddleware(prx.setLevelMiddleware, prx.capabilitiesMiddleware)
+	svr.AddSendingMiddleware(sendElicitationComplete)
+	return svr
+}
 
-	// ir.Capabilities.Completions
-	// ir.Capabilities.Logging
+// start sets the capabilities to advertise to the upstream servers, then connects to them and
+// adds their tools, prompts, resources, and resource templates. It does nothing if the upstream
+// servers have already been started.
+func (prx *Proxy) start(ctx context.Context, caps *mcp.ClientCapabilities) error {
+	if !prx.setClientCapabilities(caps) {
+		return nil
+	}
 
-	if prx.ir.Capabilities.Resources != nil {
-		err := prx.withSession(ctx, prx.updateResources)
+	for _, ups := range prx.upstreamList() {
+		err := ups.withSession(ctx, ups.initializeResult)
+		if err == nil {
+			err = ups.start(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("upstream %s: %w", ups.Name, err)
+		}
+	}
+	return nil
+}
+
+// capabilitiesMiddleware removes resource subscriptions and completions from the capabilities
+// of the proxy when no upstream server has them.
+func (prx *Proxy) capabilitiesMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(ctx, method, req)
+		ir, ok := res.(*mcp.InitializeResult)
+		if err != nil || !ok || ir.Capabilities == nil {
+			return res, err
+		}
+
+		subscribe, completions := upstreamCapabilities(prx.upstreamList())
+		if ir.Capabilities.Resources != nil && !subscribe {
+			ir.Capabilities.Resources.Subscribe = false
+		}
+		if !completions {
+			ir.Capabilities.Completions = nil
+		}
+		return ir, nil
+	}
+}
+
+// upstreamCapabilities returns whether any of the upstream servers support resource
+// subscriptions, and whether any support completions.
+func upstreamCapabilities(upstreams []*upstream) (bool, bool) {
+	var subscribe, completions bool
+	for _, ups := range upstreams {
+		if ups.ir == nil {
+			continue
+		}
+		if ups.ir.Capabilities.Resources != nil && ups.ir.Capabilities.Resources.Subscribe {
+			subscribe = true
+		}
+		if ups.ir.Capabilities.Completions != nil {
+			completions = true
+		}
+	}
+	return subscribe, completions
+}
+
+func (prx *Proxy) initialized(ctx context.Context, req *mcp.InitializedRequest) {
+	go func() {
+		req.Session.Wait()
+		prx.sessionClosed(req.Session)
+	}()
+
+	prx.updateRoots(ctx, prx.sessions(nil))
+}
+
+// sessions returns the downstream sessions, except for closed.
+func (prx *Proxy) sessions(closed *mcp.ServerSession) []*mcp.ServerSession {
+	prx.mu.Lock()
+	svr := prx.svr
+	prx.mu.Unlock()
+
+	if svr == nil {
+		return nil
+	}
+	var sessions []*mcp.ServerSession
+	for ss := range svr.Sessions() {
+		if ss != closed {
+			sessions = append(sessions, ss)
+		}
+	}
+	return sessions
+}
+
+func (prx *Proxy) sessionClosed(ss *mcp.ServerSession) {
+	prx.cancelRequests(ss)
+	prx.updateRoots(context.Background(), prx.sessions(ss))
+
+	prx.elicitMu.Lock()
+	for id, ess := range prx.elicitations {
+		if ess == ss {
+			delete(prx.elicitations, id)
+		}
+	}
+	prx.elicitMu.Unlock()
+
+	prx.unsubscribeSession(ss)
+
+	prx.logMu.Lock()
+	_, ok := prx.logLevels[ss]
+	delete(prx.logLevels, ss)
+	prx.logMu.Unlock()
+	if ok && !prx.closed.Load() {
+		// The session may have requested the most verbose level.
+		prx.setLoggingLevels(context.Background())
+	}
+}
+
+func (ups *upstream) start(ctx context.Context) error {
+	err := ups.withSession(ctx, ups.update)
+	if err != nil {
+		return err
+	}
+	ups.started.Store(true)
+	return nil
+}
+
+// update updates the tools, prompts, resources, and resource templates of the upstream from sess.
+func (ups *upstream) update(ctx context.Context, sess *mcp.ClientSession) error {
+	caps := sess.InitializeResult().Capabilities
+	if caps.Resources != nil {
+		err := ups.updateResources(ctx, sess)
+		if err != nil {
+			return err
+		}
+
+		err = ups.updateResourceTemplates(ctx, sess)
 		if err != nil {
 			return err
 		}
 	}
 
-	if prx.ir.Capabilities.Tools != nil {
-		err := prx.withSession(ctx, prx.updateTools)
+	if caps.Tools != nil {
+		err := ups.updateTools(ctx, sess)
 		if err != nil {
 			return err
 		}
 	}
 
-	if prx.ir.Capabilities.Prompts != nil {
-		err := prx.withSession(ctx, prx.updatePrompts)
+	if caps.Prompts != nil {
+		err := ups.updatePrompts(ctx, sess)
 		if err != nil {
 			return err
 		}
 	}
 
-	return prx.svr.Run(ctx, t)
+	return nil
 }
@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/leftmike/gmcpt/client"
 	mcpclnt "github.com/mark3labs/mcp-go/client"
 	mcptransport "github.com/mark3labs/mcp-go/client/transport"
 	mcpgo "github.com/mark3labs/mcp-go/mcp"
@@ -20,6 +27,40 @@ import (
 
 func init() {
 	slog.SetLogLoggerLevel(slog.LevelError)
+
+	if os.Getenv("GMCPT_TEST_SERVER") != "" {
+		runTestServer()
+	}
+}
+
+// runTestServer runs a local server, using this test binary, which counts how many times it has
+// been started in the file GMCPT_TEST_SERVER, and has an exit tool and a tool named for the count.
+func runTestServer() {
+	path := os.Getenv("GMCPT_TEST_SERVER")
+	buf, _ := os.ReadFile(path)
+	n := len(buf) + 1
+	os.WriteFile(path, append(buf, '+'), 0644)
+
+	// Without list changed notifications, the proxy must list the tools again after a restart.
+	svr := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			Capabilities: &mcp.ServerCapabilities{Tools: &mcp.ToolCapabilities{}},
+		})
+	mcp.AddTool(svr, &mcp.Tool{Name: "exit"},
+		func(ctx context.Context, req *mcp.CallToolRequest, in struct{}) (*mcp.CallToolResult,
+			any, error) {
+
+			os.Exit(1)
+			return nil, nil, nil
+		})
+	mcp.AddTool(svr, &mcp.Tool{Name: fmt.Sprintf("start%d", n)},
+		func(ctx context.Context, req *mcp.CallToolRequest, in struct{}) (*mcp.CallToolResult,
+			any, error) {
+
+			return &mcp.CallToolResult{}, nil, nil
+		})
+	svr.Run(context.Background(), &mcp.StdioTransport{})
+	os.Exit(0)
 }
 
 type testProxyFunc func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
@@ -45,9 +86,10 @@ func testProxy(t *testing.T, prx *Proxy, tsvr *mcpsvr.MCPServer, testFunc testPr
 	go func() {
 		err := prx.run(ctx, slog.Default(), &mcp.IOTransport{Reader: prxReader, Writer: prxWriter})
 		if err != nil && ctx.Err() == nil {
-			t.Fatalf("proxy.run() failed with %s", err)
+			t.Errorf("proxy.run() failed with %s", err)
 		}
 	}()
+	defer prx.Close()
 
 	clnt := mcpclnt.NewClient(mcptransport.NewIO(clntReader, clntWriter, nil))
 	err := clnt.Start(ctx)
@@ -70,8 +112,33 @@ func testProxy(t *testing.T, prx *Proxy, tsvr *mcpsvr.MCPServer, testFunc testPr
 	}
 
 	testFunc(t, ctx, clnt, tsvr)
+}
+
+// waitNotification waits for a notification with method after which done returns true. Other
+// notifications, and list changed notifications from registering the initial tools, prompts, and
+// resources which arrive before the change being waited for, are skipped.
+func waitNotification(t *testing.T, onNotify <-chan string, method string, done func() bool) {
+	timeout := 2 * time.Second
+	deadline := time.After(timeout)
+	for {
+		select {
+		case m := <-onNotify:
+			if m == method && done() {
+				return
+			}
+		case <-deadline:
+			t.Errorf("OnNotification() timed out waiting for %s after %v", method, timeout)
+			return
+		}
+	}
+}
 
-	prx.Close()
+func hasTool(ctx context.Context, clnt *mcpclnt.Client, name string) func() bool {
+	return func() bool {
+		lst, err := clnt.ListTools(ctx, mcpgo.ListToolsRequest{})
+		return err == nil && slices.ContainsFunc(lst.Tools,
+			func(tl mcpgo.Tool) bool { return tl.Name == name })
+	}
 }
 
 func newToolsMCPServer() *mcpsvr.MCPServer {
@@ -171,7 +238,16 @@ func TestProxyToolSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testTools)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testTools)
+}
+
+func TestProxyToolDetectSSE(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := httptest.NewServer(mcpsvr.NewSSEServer(tsvr))
+	defer svr.Close()
+
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse"}), tsvr, testTools)
 }
 
 func TestProxyToolHTTP(t *testing.T) {
@@ -181,7 +257,7 @@ func TestProxyToolHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testTools)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testTools)
 }
 
 func newPromptsMCPServer() *mcpsvr.MCPServer {
@@ -289,7 +365,8 @@ func TestProxyPromptsSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testPrompts)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testPrompts)
 }
 
 func TestProxyPromptsHTTP(t *testing.T) {
@@ -299,7 +376,7 @@ func TestProxyPromptsHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testPrompts)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testPrompts)
 }
 
 func newResourcesMCPServer() *mcpsvr.MCPServer {
@@ -405,7 +482,8 @@ func TestProxyResourcesSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testResources)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testResources)
 }
 
 func TestProxyResourcesHTTP(t *testing.T) {
@@ -415,7 +493,7 @@ func TestProxyResourcesHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testResources)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testResources)
 }
 
 func testToolsChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
@@ -444,15 +522,8 @@ func testToolsChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
 			return mcpgo.NewToolResultText(fmt.Sprintf("product: %g", a*b)), nil
 		})
 
-	timeout := 2 * time.Second
-	select {
-	case method := <-onNotify:
-		if method != "notifications/tools/list_changed" {
-			t.Errorf("OnNotification() got %s want notifications/tools/list_changed", method)
-		}
-	case <-time.After(timeout):
-		t.Errorf("OnNotification() timed out after %v", timeout)
-	}
+	waitNotification(t, onNotify, "notifications/tools/list_changed",
+		hasTool(ctx, clnt, "multiply"))
 
 	testListTools(t, ctx, clnt, []string{"echo", "add", "multiply"})
 	testToolCall(t, ctx, clnt, "echo", map[string]any{"message": "hello world"},
@@ -468,7 +539,8 @@ func TestProxyToolsChangedSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testToolsChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testToolsChanged)
 }
 
 func TestProxyToolsChangedHTTP(t *testing.T) {
@@ -478,7 +550,7 @@ func TestProxyToolsChangedHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testToolsChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testToolsChanged)
 }
 
 func testPromptsChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
@@ -508,15 +580,11 @@ func testPromptsChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
 			), nil
 		})
 
-	timeout := 2 * time.Second
-	select {
-	case method := <-onNotify:
-		if method != "notifications/prompts/list_changed" {
-			t.Errorf("OnNotification() got %s want notifications/prompts/list_changed", method)
-		}
-	case <-time.After(timeout):
-		t.Errorf("OnNotification() timed out after %v", timeout)
-	}
+	waitNotification(t, onNotify, "notifications/prompts/list_changed", func() bool {
+		lst, err := clnt.ListPrompts(ctx, mcpgo.ListPromptsRequest{})
+		return err == nil && slices.ContainsFunc(lst.Prompts,
+			func(pr mcpgo.Prompt) bool { return pr.Name == "farewell" })
+	})
 
 	testListPrompts(t, ctx, clnt, []string{"greet", "help", "farewell"})
 	testGetPrompt(t, ctx, clnt, "greet", map[string]string{"name": "Dog"}, "Hello, Dog!",
@@ -533,7 +601,8 @@ func TestProxyPromptsChangedSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testPromptsChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testPromptsChanged)
 }
 
 func TestProxyPromptsChangedHTTP(t *testing.T) {
@@ -543,7 +612,7 @@ func TestProxyPromptsChangedHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testPromptsChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testPromptsChanged)
 }
 
 func testResourcesChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
@@ -570,15 +639,11 @@ func testResourcesChanged(t *testing.T, ctx context.Context, clnt *mcpclnt.Clien
 			}, nil
 		})
 
-	timeout := 2 * time.Second
-	select {
-	case method := <-onNotify:
-		if method != "notifications/resources/list_changed" {
-			t.Errorf("OnNotification() got %s want notifications/resources/list_changed", method)
-		}
-	case <-time.After(timeout):
-		t.Errorf("OnNotification() timed out after %v", timeout)
-	}
+	waitNotification(t, onNotify, "notifications/resources/list_changed", func() bool {
+		lst, err := clnt.ListResources(ctx, mcpgo.ListResourcesRequest{})
+		return err == nil && slices.ContainsFunc(lst.Resources,
+			func(r mcpgo.Resource) bool { return r.URI == "file:///notes.txt" })
+	})
 
 	testListResources(t, ctx, clnt,
 		[]string{"file:///config.json", "file:///readme.txt", "file:///notes.txt"})
@@ -594,7 +659,8 @@ func TestProxyResourcesChangedSSE(t *testing.T) {
 
 	fmt.Println("sse server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/sse", "", "", true), tsvr, testResourcesChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport}),
+		tsvr, testResourcesChanged)
 }
 
 func TestProxyResourcesChangedHTTP(t *testing.T) {
@@ -604,7 +670,7 @@ func TestProxyResourcesChangedHTTP(t *testing.T) {
 
 	fmt.Println("streamable http server url:", svr.URL)
 
-	testProxy(t, NewProxy(svr.URL+"/mcp", "", "", false), tsvr, testResourcesChanged)
+	testProxy(t, NewProxy(Upstream{URL: svr.URL + "/mcp"}), tsvr, testResourcesChanged)
 }
 
 func requireAPIKey(handler http.Handler, headerName, apiKey string) http.Handler {
@@ -635,16 +701,16 @@ func TestProxyAPIKey(t *testing.T) {
 	}
 
 	configs := []struct {
-		nhfn func(tsvr *mcpsvr.MCPServer) http.Handler
-		ep   string
-		sse  bool
+		nhfn      func(tsvr *mcpsvr.MCPServer) http.Handler
+		ep        string
+		transport string
 	}{
 		{
 			nhfn: func(tsvr *mcpsvr.MCPServer) http.Handler {
 				return mcpsvr.NewSSEServer(tsvr)
 			},
-			ep:  "/sse",
-			sse: true,
+			ep:        "/sse",
+			transport: client.SSETransport,
 		},
 		{
 			nhfn: func(tsvr *mcpsvr.MCPServer) http.Handler {
@@ -658,20 +724,1801 @@ func TestProxyAPIKey(t *testing.T) {
 		for _, cfg := range configs {
 			tsvr := newToolsMCPServer()
 			svr := httptest.NewServer(requireAPIKey(cfg.nhfn(tsvr), c.h, c.key))
-			prx := NewProxy(svr.URL+cfg.ep, c.pkey, c.ph, cfg.sse)
+			prx := NewProxy(Upstream{
+				URL:       svr.URL + cfg.ep,
+				APIKey:    c.pkey,
+				Header:    c.ph,
+				Transport: cfg.transport,
+			})
 
 			if c.fail {
+				// The upstream is connected when the downstream client initializes.
 				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 				defer cancel()
 
-				err := prx.run(ctx, slog.Default(), &mcp.IOTransport{Reader: nil, Writer: nil})
+				prxReader, clntWriter := io.Pipe()
+				clntReader, prxWriter := io.Pipe()
+				go prx.run(ctx, slog.Default(),
+					&mcp.IOTransport{Reader: prxReader, Writer: prxWriter})
+
+				sess, err := newTestClient(nil).Connect(ctx,
+					&mcp.IOTransport{Reader: clntReader, Writer: clntWriter}, nil)
 				if err == nil {
-					t.Errorf("Proxy.run(%s, %v) did not fail", cfg.ep, c)
-					prx.Close()
+					t.Errorf("Connect(%s, %v) did not fail", cfg.ep, c)
+					sess.Close()
 				}
+				prx.Close()
+				prxReader.Close()
+				prxWriter.Close()
 			} else {
 				testProxy(t, prx, tsvr, testTools)
 			}
 		}
 	}
 }
+
+func newMultiplyMCPServer() *mcpsvr.MCPServer {
+	tsvr := mcpsvr.NewMCPServer("test-upstream-server", "0.1.0", mcpsvr.WithToolCapabilities(true))
+
+	tsvr.AddTool(mcpgo.NewTool("multiply",
+		mcpgo.WithDescription("multiplies two numbers"),
+		mcpgo.WithNumber("a", mcpgo.Required()),
+		mcpgo.WithNumber("b", mcpgo.Required())),
+		func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+			a := req.GetFloat("a", 0)
+			b := req.GetFloat("b", 0)
+			return mcpgo.NewToolResultText(fmt.Sprintf("product: %g", a*b)), nil
+		})
+
+	tsvr.AddTool(mcpgo.NewTool("echo",
+		mcpgo.WithDescription("duplicate of echo"),
+		mcpgo.WithString("message", mcpgo.Required())),
+		func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+			return mcpgo.NewToolResultText("duplicate echo"), nil
+		})
+
+	return tsvr
+}
+
+func TestProxyMultipleUpstreams(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := httptest.NewServer(mcpsvr.NewSSEServer(tsvr))
+	defer svr.Close()
+
+	msvr := newMultiplyMCPServer()
+	svr2 := mcpsvr.NewTestStreamableHTTPServer(msvr)
+	defer svr2.Close()
+
+	psvr := mcpsvr.NewTestStreamableHTTPServer(newPromptsMCPServer())
+	defer psvr.Close()
+
+	rsvr := mcpsvr.NewTestStreamableHTTPServer(newResourcesMCPServer())
+	defer rsvr.Close()
+
+	prx := NewProxy(
+		Upstream{URL: svr.URL + "/sse", Transport: client.SSETransport},
+		Upstream{URL: svr2.URL + "/mcp"},
+		Upstream{URL: psvr.URL + "/mcp"},
+		Upstream{URL: rsvr.URL + "/mcp"},
+	)
+	testProxy(t, prx, tsvr,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan string, 4)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				onNotify <- notify.Method
+			})
+
+			testListTools(t, ctx, clnt, []string{"echo", "add", "multiply"})
+			testToolCall(t, ctx, clnt, "echo", map[string]any{"message": "hello world"},
+				"echo: hello world")
+			testToolCall(t, ctx, clnt, "add", map[string]any{"a": 3.5, "b": 2.5}, "sum: 6")
+			testToolCall(t, ctx, clnt, "multiply", map[string]any{"a": 3.0, "b": 4.0},
+				"product: 12")
+
+			testPrompts(t, ctx, clnt, nil)
+			testResources(t, ctx, clnt, nil)
+
+			msvr.AddTool(mcpgo.NewTool("divide",
+				mcpgo.WithNumber("a", mcpgo.Required()),
+				mcpgo.WithNumber("b", mcpgo.Required())),
+				func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult,
+					error) {
+
+					a := req.GetFloat("a", 0)
+					b := req.GetFloat("b", 0)
+					return mcpgo.NewToolResultText(fmt.Sprintf("quotient: %g", a/b)), nil
+				})
+
+			waitNotification(t, onNotify, "notifications/tools/list_changed",
+				hasTool(ctx, clnt, "divide"))
+
+			testListTools(t, ctx, clnt, []string{"echo", "add", "multiply", "divide"})
+			testToolCall(t, ctx, clnt, "divide", map[string]any{"a": 12.0, "b": 4.0},
+				"quotient: 3")
+
+			// When the upstream which owns echo drops it, the duplicate from the other upstream
+			// is added.
+			tsvr.DeleteTools("echo")
+			waitNotification(t, onNotify, "notifications/tools/list_changed", func() bool {
+				lst, err := clnt.ListTools(ctx, mcpgo.ListToolsRequest{})
+				return err == nil && slices.ContainsFunc(lst.Tools, func(tl mcpgo.Tool) bool {
+					return tl.Name == "echo" && tl.Description == "duplicate of echo"
+				})
+			})
+
+			testListTools(t, ctx, clnt, []string{"echo", "add", "multiply", "divide"})
+			testToolCall(t, ctx, clnt, "echo", map[string]any{"message": "hello world"},
+				"duplicate echo")
+		})
+}
+
+func TestProxyListFails(t *testing.T) {
+	var fail atomic.Bool
+	failed := make(chan string, 8)
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		nil)
+	usvr.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if fail.Load() && strings.HasSuffix(method, "/list") {
+				failed <- method
+				return nil, fmt.Errorf("%s failed", method)
+			}
+			return next(ctx, method, req)
+		}
+	})
+
+	textTool := func(name string) (*mcp.Tool, mcp.ToolHandler) {
+		return &mcp.Tool{Name: name, InputSchema: map[string]any{"type": "object"}},
+			func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{&mcp.TextContent{Text: name}},
+				}, nil
+			}
+	}
+	usvr.AddTool(textTool("echo"))
+	usvr.AddResource(&mcp.Resource{URI: "file:///a.txt", Name: "a.txt"},
+		func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult,
+			error) {
+
+			return &mcp.ReadResourceResult{
+				Contents: []*mcp.ResourceContents{{URI: "file:///a.txt", Text: "a"}},
+			}, nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prx := NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+
+	changed := make(chan struct{}, 8)
+	sess := connectProxy(t, ctx, prx, newTestClient(&mcp.ClientOptions{
+		ToolListChangedHandler: func(ctx context.Context, req *mcp.ToolListChangedRequest) {
+			changed <- struct{}{}
+		},
+	}))
+	defer sess.Close()
+
+	waitFailed := func(method string) {
+		t.Helper()
+
+		for {
+			select {
+			case m := <-failed:
+				if m == method {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%s did not fail", method)
+			}
+		}
+	}
+
+	testLists := func(tools, uris []string) {
+		t.Helper()
+
+		lst, err := sess.ListTools(ctx, nil)
+		if err != nil {
+			t.Fatalf("ListTools() failed with %s", err)
+		}
+		var names []string
+		for _, tl := range lst.Tools {
+			names = append(names, tl.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, tools) {
+			t.Errorf("ListTools() got %v want %v", names, tools)
+		}
+
+		rlst, err := sess.ListResources(ctx, nil)
+		if err != nil {
+			t.Fatalf("ListResources() failed with %s", err)
+		}
+		var got []string
+		for _, rs := range rlst.Resources {
+			got = append(got, rs.URI)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, uris) {
+			t.Errorf("ListResources() got %v want %v", got, uris)
+		}
+	}
+
+	// When the upstream can not be listed after it changes, the last lists are kept.
+	fail.Store(true)
+	usvr.AddTool(textTool("shout"))
+	waitFailed("tools/list")
+	usvr.AddResource(&mcp.Resource{URI: "file:///b.txt", Name: "b.txt"}, nil)
+	waitFailed("resources/list")
+	waitFailed("resources/templates/list")
+
+	testLists([]string{"echo"}, []string{"file:///a.txt"})
+	ret, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: "echo"})
+	if err != nil {
+		t.Fatalf("CallTool(echo) failed with %s", err)
+	} else if tc, ok := ret.Content[0].(*mcp.TextContent); !ok || tc.Text != "echo" {
+		t.Errorf("CallTool(echo) got %v want echo", ret.Content[0])
+	}
+
+	// The next change updates the lists.
+	fail.Store(false)
+	for len(changed) > 0 {
+		<-changed
+	}
+	usvr.AddTool(textTool("whisper"))
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("ToolListChanged() timed out")
+	}
+	testLists([]string{"echo", "shout", "whisper"}, []string{"file:///a.txt"})
+}
+
+func TestUpstreamNames(t *testing.T) {
+	prx := NewProxy(
+		Upstream{URL: "https://example.com/mcp"},
+		Upstream{URL: "https://example.com/sse", Transport: client.SSETransport},
+		Upstream{Command: "/usr/bin/server", Args: []string{"-stdio"}},
+		Upstream{Name: "named", URL: "https://example.org/mcp"},
+	)
+
+	want := []string{"example.com", "example.com-2", "server", "named"}
+	var got []string
+	for _, ups := range prx.upstreams {
+		got = append(got, ups.Name)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("NewProxy() got names %v want %v", got, want)
+	}
+}
+
+func TestSchemeName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{name: "files", want: "files"},
+		{name: "my_files", want: "my-files"},
+		{name: "my api", want: "my-api"},
+		{name: "example.com-2", want: "example.com-2"},
+		{name: "127.0.0.1", want: "x-127.0.0.1"},
+		{name: "mcp+server", want: "mcp-server"},
+		{name: "café", want: "caf-"},
+		{name: "", want: "x-"},
+	}
+
+	for _, c := range cases {
+		got := schemeName(c.name)
+		if got != c.want {
+			t.Errorf("schemeName(%s) got %s want %s", c.name, got, c.want)
+		}
+		if _, err := url.Parse(got + "+file:///x"); err != nil {
+			t.Errorf("schemeName(%s) got %s: url.Parse() failed with %s", c.name, got, err)
+		}
+	}
+}
+
+func TestProxyNamespace(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	msvr := mcpsvr.NewTestStreamableHTTPServer(newMultiplyMCPServer())
+	defer msvr.Close()
+
+	psvr := mcpsvr.NewTestStreamableHTTPServer(newPromptsMCPServer())
+	defer psvr.Close()
+
+	rsvr := mcpsvr.NewTestStreamableHTTPServer(newResourcesMCPServer())
+	defer rsvr.Close()
+
+	lsvr := newResourcesMCPServer()
+	lsvr.AddTool(mcpgo.NewTool("link"),
+		func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+			return &mcpgo.CallToolResult{
+				Content: []mcpgo.Content{
+					mcpgo.NewResourceLink("file:///readme.txt", "readme.txt", "", ""),
+					mcpgo.NewEmbeddedResource(mcpgo.TextResourceContents{
+						URI:  "file:///config.json",
+						Text: `{"version": "1.0", "debug": true}`,
+					}),
+				},
+			}, nil
+		})
+	hsvr := mcpsvr.NewTestStreamableHTTPServer(lsvr)
+	defer hsvr.Close()
+
+	prx := NewProxy(
+		Upstream{Name: "a", URL: svr.URL + "/mcp", Namespace: PrefixNamespace},
+		Upstream{
+			Name:      "b",
+			URL:       msvr.URL + "/mcp",
+			Namespace: SuffixNamespace,
+			Separator: "-",
+			Rename:    map[string]string{"echo": "shout"},
+		},
+		Upstream{Name: "p", URL: psvr.URL + "/mcp", Namespace: PrefixNamespace},
+		Upstream{Name: "r", URL: rsvr.URL + "/mcp", Namespace: PrefixNamespace},
+		Upstream{Name: "my_files", URL: hsvr.URL + "/mcp", Namespace: PrefixNamespace},
+		Upstream{URL: hsvr.URL + "/mcp", Namespace: PrefixNamespace},
+	)
+	testProxy(t, prx, tsvr,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			testListTools(t, ctx, clnt, []string{"a__echo", "a__add", "multiply-b", "shout",
+				"my_files__link", "127.0.0.1__link"})
+			testToolCall(t, ctx, clnt, "a__echo", map[string]any{"message": "hello world"},
+				"echo: hello world")
+			testToolCall(t, ctx, clnt, "a__add", map[string]any{"a": 3.5, "b": 2.5}, "sum: 6")
+			testToolCall(t, ctx, clnt, "multiply-b", map[string]any{"a": 3.0, "b": 4.0},
+				"product: 12")
+			testToolCall(t, ctx, clnt, "shout", map[string]any{"message": "hello world"},
+				"duplicate echo")
+
+			testListPrompts(t, ctx, clnt, []string{"p__greet", "p__help"})
+			testGetPrompt(t, ctx, clnt, "p__greet", map[string]string{"name": "World"},
+				"Hello, World!", mcpgo.RoleUser)
+
+			testListResources(t, ctx, clnt,
+				[]string{"r+file:///config.json", "r+file:///readme.txt",
+					"my-files+file:///config.json", "my-files+file:///readme.txt",
+					"x-127.0.0.1+file:///config.json", "x-127.0.0.1+file:///readme.txt"})
+			testReadResource(t, ctx, clnt, "r+file:///readme.txt", "Welcome to the project!")
+			testReadResource(t, ctx, clnt, "my-files+file:///readme.txt",
+				"Welcome to the project!")
+			testReadResource(t, ctx, clnt, "x-127.0.0.1+file:///readme.txt",
+				"Welcome to the project!")
+
+			cret, err := clnt.CallTool(ctx, mcpgo.CallToolRequest{
+				Params: mcpgo.CallToolParams{Name: "my_files__link"},
+			})
+			if err != nil {
+				t.Errorf("CallTool(my_files__link) failed with %s", err)
+			} else if len(cret.Content) != 2 {
+				t.Errorf("CallTool(my_files__link) got %d contents want 2", len(cret.Content))
+			} else {
+				if rl, ok := cret.Content[0].(mcpgo.ResourceLink); !ok {
+					t.Errorf("CallTool(my_files__link) expected ResourceLink, got %T",
+						cret.Content[0])
+				} else if rl.URI != "my-files+file:///readme.txt" {
+					t.Errorf("CallTool(my_files__link) got link %s want %s", rl.URI,
+						"my-files+file:///readme.txt")
+				}
+
+				if er, ok := cret.Content[1].(mcpgo.EmbeddedResource); !ok {
+					t.Errorf("CallTool(my_files__link) expected EmbeddedResource, got %T",
+						cret.Content[1])
+				} else if tc, ok := mcpgo.AsTextResourceContents(er.Resource); !ok {
+					t.Errorf("CallTool(my_files__link) expected TextResourceContents, got %T",
+						er.Resource)
+				} else if tc.URI != "my-files+file:///config.json" {
+					t.Errorf("CallTool(my_files__link) got resource %s want %s", tc.URI,
+						"my-files+file:///config.json")
+				}
+			}
+
+			ret, err := clnt.ReadResource(ctx, mcpgo.ReadResourceRequest{
+				Params: mcpgo.ReadResourceParams{URI: "r+file:///config.json"},
+			})
+			if err != nil {
+				t.Errorf("ReadResource(r+file:///config.json) failed with %s", err)
+			} else if tc, ok := mcpgo.AsTextResourceContents(ret.Contents[0]); !ok {
+				t.Errorf("ReadResource(r+file:///config.json) expected TextResourceContents")
+			} else if tc.URI != "r+file:///config.json" {
+				t.Errorf("ReadResource(r+file:///config.json) got uri %s", tc.URI)
+			}
+		})
+}
+
+func TestProxyFilter(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	psvr := mcpsvr.NewTestStreamableHTTPServer(newPromptsMCPServer())
+	defer psvr.Close()
+
+	rsvr := mcpsvr.NewTestStreamableHTTPServer(newResourcesMCPServer())
+	defer rsvr.Close()
+
+	prx := NewProxy(
+		Upstream{URL: svr.URL + "/mcp", Filter: Filter{DenyTools: []string{"add"}}},
+		Upstream{URL: psvr.URL + "/mcp", Filter: Filter{AllowPrompts: []string{"gr*"}}},
+		Upstream{URL: rsvr.URL + "/mcp", Filter: Filter{DenyResources: []string{"*.json"}}},
+	)
+	testProxy(t, prx, tsvr,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			testListTools(t, ctx, clnt, []string{"echo"})
+			testToolCall(t, ctx, clnt, "echo", map[string]any{"message": "hello world"},
+				"echo: hello world")
+			_, err := clnt.CallTool(ctx, mcpgo.CallToolRequest{
+				Params: mcpgo.CallToolParams{
+					Name:      "add",
+					Arguments: map[string]any{"a": 1, "b": 2},
+				},
+			})
+			if err == nil {
+				t.Error("CallTool(add) did not fail")
+			}
+
+			testListPrompts(t, ctx, clnt, []string{"greet"})
+			testListResources(t, ctx, clnt, []string{"file:///readme.txt"})
+			_, err = clnt.ReadResource(ctx, mcpgo.ReadResourceRequest{
+				Params: mcpgo.ReadResourceParams{URI: "file:///config.json"},
+			})
+			if err == nil {
+				t.Error("ReadResource(file:///config.json) did not fail")
+			}
+		})
+}
+
+func newTemplatesMCPServer() *mcpsvr.MCPServer {
+	tsvr := mcpsvr.NewMCPServer("test-upstream-server", "0.1.0",
+		mcpsvr.WithResourceCapabilities(false, true))
+
+	tsvr.AddResourceTemplate(
+		mcpgo.NewResourceTemplate("file:///docs/{name}", "docs",
+			mcpgo.WithTemplateDescription("Project documents")),
+		func(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents,
+			error) {
+
+			return []mcpgo.ResourceContents{
+				mcpgo.TextResourceContents{
+					URI:  req.Params.URI,
+					Text: fmt.Sprintf("document %s", req.Params.URI),
+				},
+			}, nil
+		})
+
+	return tsvr
+}
+
+func testListResourceTemplates(t *testing.T, ctx context.Context, clnt *mcpclnt.Client,
+	templates []string) {
+
+	lst, err := clnt.ListResourceTemplates(ctx, mcpgo.ListResourceTemplatesRequest{})
+	if err != nil {
+		t.Errorf("ListResourceTemplates() failed with %s", err)
+		return
+	}
+
+	var got []string
+	for _, rt := range lst.ResourceTemplates {
+		got = append(got, rt.URITemplate.Raw())
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, templates) {
+		t.Errorf("ListResourceTemplates() got %v want %v", got, templates)
+	}
+}
+
+func TestProxyResourceTemplates(t *testing.T) {
+	tsvr := newTemplatesMCPServer()
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	rsvr := mcpsvr.NewTestStreamableHTTPServer(newTemplatesMCPServer())
+	defer rsvr.Close()
+
+	prx := NewProxy(
+		Upstream{URL: svr.URL + "/mcp"},
+		Upstream{Name: "ns", URL: rsvr.URL + "/mcp", Namespace: PrefixNamespace},
+	)
+	testProxy(t, prx, tsvr,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan string, 4)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				onNotify <- notify.Method
+			})
+
+			testListResourceTemplates(t, ctx, clnt,
+				[]string{"file:///docs/{name}", "ns+file:///docs/{name}"})
+			testReadResource(t, ctx, clnt, "file:///docs/readme",
+				"document file:///docs/readme")
+			testReadResource(t, ctx, clnt, "ns+file:///docs/readme",
+				"document file:///docs/readme")
+			_, err := clnt.ReadResource(ctx, mcpgo.ReadResourceRequest{
+				Params: mcpgo.ReadResourceParams{URI: "file:///other/readme"},
+			})
+			if err == nil {
+				t.Error("ReadResource(file:///other/readme) did not fail")
+			}
+
+			tsvr.AddResourceTemplate(
+				mcpgo.NewResourceTemplate("file:///notes/{name}", "notes"),
+				func(ctx context.Context, req mcpgo.ReadResourceRequest) (
+					[]mcpgo.ResourceContents, error) {
+
+					return []mcpgo.ResourceContents{
+						mcpgo.TextResourceContents{URI: req.Params.URI, Text: "note"},
+					}, nil
+				})
+
+			waitNotification(t, onNotify, "notifications/resources/list_changed", func() bool {
+				lst, err := clnt.ListResourceTemplates(ctx, mcpgo.ListResourceTemplatesRequest{})
+				return err == nil && slices.ContainsFunc(lst.ResourceTemplates,
+					func(rt mcpgo.ResourceTemplate) bool {
+						return rt.URITemplate.Raw() == "file:///notes/{name}"
+					})
+			})
+
+			testListResourceTemplates(t, ctx, clnt, []string{"file:///docs/{name}",
+				"file:///notes/{name}", "ns+file:///docs/{name}"})
+			testReadResource(t, ctx, clnt, "file:///notes/todo", "note")
+		})
+}
+
+func TestProxySubscribe(t *testing.T) {
+	subscribed := make(chan string, 4)
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			SubscribeHandler: func(ctx context.Context, req *mcp.SubscribeRequest) error {
+				subscribed <- "subscribe " + req.Params.URI
+				return nil
+			},
+			UnsubscribeHandler: func(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+				subscribed <- "unsubscribe " + req.Params.URI
+				return nil
+			},
+		})
+	usvr.AddResource(&mcp.Resource{URI: "file:///status.txt", Name: "status.txt"},
+		func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult,
+			error) {
+
+			return &mcp.ReadResourceResult{
+				Contents: []*mcp.ResourceContents{
+					{URI: req.Params.URI, Text: "ok"},
+				},
+			}, nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	prx := NewProxy(Upstream{Name: "ns", URL: svr.URL, Namespace: PrefixNamespace})
+	testProxy(t, prx, nil,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan mcpgo.JSONRPCNotification, 4)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				// Skip list changed notifications from registering the initial tools,
+				// prompts, and resources.
+				if !strings.HasSuffix(notify.Method, "/list_changed") {
+					onNotify <- notify
+				}
+			})
+
+			timeout := 2 * time.Second
+			expect := func(want string) {
+				select {
+				case got := <-subscribed:
+					if got != want {
+						t.Errorf("upstream got %s want %s", got, want)
+					}
+				case <-time.After(timeout):
+					t.Errorf("upstream %s timed out after %v", want, timeout)
+				}
+			}
+
+			err := clnt.Subscribe(ctx, mcpgo.SubscribeRequest{
+				Params: mcpgo.SubscribeParams{URI: "ns+file:///status.txt"},
+			})
+			if err != nil {
+				t.Fatalf("Subscribe() failed with %s", err)
+			}
+			expect("subscribe file:///status.txt")
+
+			err = clnt.Subscribe(ctx, mcpgo.SubscribeRequest{
+				Params: mcpgo.SubscribeParams{URI: "ns+file:///missing.txt"},
+			})
+			if err == nil {
+				t.Error("Subscribe(ns+file:///missing.txt) did not fail")
+			}
+
+			err = usvr.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{
+				URI: "file:///status.txt",
+			})
+			if err != nil {
+				t.Fatalf("ResourceUpdated() failed with %s", err)
+			}
+
+			select {
+			case notify := <-onNotify:
+				if notify.Method != "notifications/resources/updated" {
+					t.Errorf("OnNotification() got %s want notifications/resources/updated",
+						notify.Method)
+				} else if uri := notify.Params.AdditionalFields["uri"]; uri !=
+					"ns+file:///status.txt" {
+
+					t.Errorf("OnNotification() got %v want ns+file:///status.txt", uri)
+				}
+			case <-time.After(timeout):
+				t.Errorf("OnNotification() timed out after %v", timeout)
+			}
+
+			err = clnt.Unsubscribe(ctx, mcpgo.UnsubscribeRequest{
+				Params: mcpgo.UnsubscribeParams{URI: "ns+file:///status.txt"},
+			})
+			if err != nil {
+				t.Fatalf("Unsubscribe() failed with %s", err)
+			}
+			expect("unsubscribe file:///status.txt")
+		})
+}
+
+func TestProxyComplete(t *testing.T) {
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			CompletionHandler: func(ctx context.Context, req *mcp.CompleteRequest) (
+				*mcp.CompleteResult, error) {
+
+				ref := req.Params.Ref
+				arg := req.Params.Argument
+				return &mcp.CompleteResult{
+					Completion: mcp.CompletionResultDetails{
+						Values: []string{
+							fmt.Sprintf("%s%s:%s=%s", ref.Name, ref.URI, arg.Name, arg.Value),
+						},
+					},
+				}, nil
+			},
+		})
+	for _, name := range []string{"greet", "bye"} {
+		usvr.AddPrompt(&mcp.Prompt{
+			Name:      name,
+			Arguments: []*mcp.PromptArgument{{Name: "name"}},
+		}, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return &mcp.GetPromptResult{}, nil
+		})
+	}
+	usvr.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: "file:///docs/{path}",
+		Name:        "docs",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult,
+		error) {
+
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	prx := NewProxy(Upstream{
+		Name:      "ns",
+		URL:       svr.URL,
+		Namespace: PrefixNamespace,
+		Rename:    map[string]string{"greet": "hello"},
+	})
+	testProxy(t, prx, nil,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			cases := []struct {
+				ref   any
+				value string
+				want  string
+				fail  bool
+			}{
+				{
+					ref:   mcpgo.PromptReference{Type: "ref/prompt", Name: "hello"},
+					value: "al",
+					want:  "greet:arg=al",
+				},
+				{
+					ref:   mcpgo.PromptReference{Type: "ref/prompt", Name: "ns__bye"},
+					value: "b",
+					want:  "bye:arg=b",
+				},
+				{
+					ref: mcpgo.ResourceReference{
+						Type: "ref/resource",
+						URI:  "ns+file:///docs/{path}",
+					},
+					value: "re",
+					want:  "file:///docs/{path}:arg=re",
+				},
+				{
+					ref:  mcpgo.PromptReference{Type: "ref/prompt", Name: "greet"},
+					fail: true,
+				},
+				{
+					ref:  mcpgo.PromptReference{Type: "ref/prompt", Name: "ns__greet"},
+					fail: true,
+				},
+				{
+					ref:  mcpgo.ResourceReference{Type: "ref/resource", URI: "file:///docs/{path}"},
+					fail: true,
+				},
+			}
+
+			for _, c := range cases {
+				req := mcpgo.CompleteRequest{}
+				req.Params.Ref = c.ref
+				req.Params.Argument.Name = "arg"
+				req.Params.Argument.Value = c.value
+				ret, err := clnt.Complete(ctx, req)
+				if c.fail {
+					if err == nil {
+						t.Errorf("Complete(%v) did not fail", c.ref)
+					}
+				} else if err != nil {
+					t.Errorf("Complete(%v) failed with %s", c.ref, err)
+				} else if !slices.Equal(ret.Completion.Values, []string{c.want}) {
+					t.Errorf("Complete(%v) got %v want %s", c.ref, ret.Completion.Values, c.want)
+				}
+			}
+		})
+}
+
+func TestProxyLogging(t *testing.T) {
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		nil)
+	setLevel := make(chan mcp.LoggingLevel, 16)
+	usvr.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if params, ok := req.GetParams().(*mcp.SetLoggingLevelParams); ok {
+				setLevel <- params.Level
+			}
+			return next(ctx, method, req)
+		}
+	})
+	usvr.AddTool(&mcp.Tool{Name: "work", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			for _, level := range []mcp.LoggingLevel{"debug", "warning"} {
+				err := req.Session.Log(ctx, &mcp.LoggingMessageParams{
+					Level: level,
+					Data:  fmt.Sprintf("%s message", level),
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}},
+				nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	prx := NewProxy(Upstream{Name: "ns", URL: svr.URL})
+	testProxy(t, prx, nil,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan mcpgo.JSONRPCNotification, 4)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				// Skip list changed notifications from registering the initial tools,
+				// prompts, and resources.
+				if !strings.HasSuffix(notify.Method, "/list_changed") {
+					onNotify <- notify
+				}
+			})
+
+			err := clnt.SetLevel(ctx, mcpgo.SetLevelRequest{
+				Params: mcpgo.SetLevelParams{Level: mcpgo.LoggingLevelWarning},
+			})
+			if err != nil {
+				t.Fatalf("SetLevel() failed with %s", err)
+			}
+
+			testToolCall(t, ctx, clnt, "work", nil, "done")
+
+			timeout := 2 * time.Second
+			select {
+			case notify := <-onNotify:
+				fields := notify.Params.AdditionalFields
+				if notify.Method != "notifications/message" {
+					t.Errorf("OnNotification() got %s want notifications/message", notify.Method)
+				} else if fields["level"] != "warning" || fields["data"] != "warning message" ||
+					fields["logger"] != "ns" {
+
+					t.Errorf("OnNotification() got %v", fields)
+				}
+			case <-time.After(timeout):
+				t.Errorf("OnNotification() timed out after %v", timeout)
+			}
+
+			select {
+			case notify := <-onNotify:
+				t.Errorf("OnNotification() got unexpected %s %v", notify.Method,
+					notify.Params.AdditionalFields)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+
+	// When a downstream session closes, the upstream server is set to the most verbose level
+	// requested by the remaining sessions.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prx = NewProxy(Upstream{Name: "ns", URL: svr.URL})
+	defer prx.Close()
+	addr, _ := listenProxy(t, ctx, prx)
+
+	for len(setLevel) > 0 {
+		<-setLevel
+	}
+
+	var sessions []*mcp.ClientSession
+	for _, level := range []mcp.LoggingLevel{"warning", "debug"} {
+		sess, err := newTestClient(nil).Connect(ctx,
+			&mcp.StreamableClientTransport{Endpoint: "http://" + addr + "/mcp"}, nil)
+		if err != nil {
+			t.Fatalf("Connect() failed with %s", err)
+		}
+		defer sess.Close()
+		sessions = append(sessions, sess)
+
+		err = sess.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: level})
+		if err != nil {
+			t.Fatalf("SetLoggingLevel(%s) failed with %s", level, err)
+		}
+	}
+
+	sessions[1].Close()
+	timeout := 2 * time.Second
+	for _, want := range []mcp.LoggingLevel{"warning", "debug", "warning"} {
+		select {
+		case level := <-setLevel:
+			if level != want {
+				t.Errorf("SetLoggingLevel() got %s want %s", level, want)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("SetLoggingLevel(%s) timed out after %v", want, timeout)
+		}
+	}
+}
+
+func TestProxyProgress(t *testing.T) {
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		nil)
+	usvr.AddTool(&mcp.Tool{Name: "slow", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			token := req.Params.GetProgressToken()
+			if token == nil {
+				return nil, fmt.Errorf("missing progress token")
+			}
+			for n := range 2 {
+				err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+					ProgressToken: token,
+					Progress:      float64(n + 1),
+					Total:         2,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}},
+				nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	prx := NewProxy(Upstream{URL: svr.URL})
+	testProxy(t, prx, nil,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan mcpgo.JSONRPCNotification, 4)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				// Skip list changed notifications from registering the initial tools,
+				// prompts, and resources.
+				if !strings.HasSuffix(notify.Method, "/list_changed") {
+					onNotify <- notify
+				}
+			})
+
+			ret, err := clnt.CallTool(ctx, mcpgo.CallToolRequest{
+				Params: mcpgo.CallToolParams{
+					Name: "slow",
+					Meta: &mcpgo.Meta{ProgressToken: "tok-1"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("CallTool(slow) failed with %s", err)
+			} else if ret.IsError {
+				t.Fatalf("CallTool(slow) returned an error: %v", ret.Content)
+			}
+
+			timeout := 2 * time.Second
+			for n := range 2 {
+				select {
+				case notify := <-onNotify:
+					fields := notify.Params.AdditionalFields
+					if notify.Method != "notifications/progress" {
+						t.Errorf("OnNotification() got %s want notifications/progress",
+							notify.Method)
+					} else if fields["progressToken"] != "tok-1" ||
+						fields["progress"] != float64(n+1) {
+
+						t.Errorf("OnNotification() got %v", fields)
+					}
+				case <-time.After(timeout):
+					t.Errorf("OnNotification() timed out after %v", timeout)
+				}
+			}
+		})
+}
+
+func TestProxyCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		nil)
+	usvr.AddTool(&mcp.Tool{Name: "block", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				cancelled <- struct{}{}
+				return nil, ctx.Err()
+			case <-time.After(10 * time.Second):
+				return &mcp.CallToolResult{}, nil
+			}
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	waitFor := func(ch chan struct{}, what string) {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Errorf("upstream tool not %s", what)
+		}
+	}
+
+	for _, disconnect := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		prxReader, clntWriter := io.Pipe()
+		clntReader, prxWriter := io.Pipe()
+		prx := NewProxy(Upstream{URL: svr.URL})
+		defer prx.Close()
+
+		go func() {
+			err := prx.run(ctx, slog.Default(),
+				&mcp.IOTransport{Reader: prxReader, Writer: prxWriter})
+			if err != nil && ctx.Err() == nil && !disconnect {
+				t.Errorf("proxy.run() failed with %s", err)
+			}
+		}()
+
+		clnt := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, nil)
+		sess, err := clnt.Connect(ctx,
+			&mcp.IOTransport{Reader: clntReader, Writer: clntWriter}, nil)
+		if err != nil {
+			t.Fatalf("Connect() failed with %s", err)
+		}
+
+		callCtx, callCancel := context.WithCancel(ctx)
+		defer callCancel()
+
+		go func() {
+			waitFor(started, "started")
+			if disconnect {
+				clntWriter.Close()
+				prxWriter.Close()
+			} else {
+				callCancel()
+			}
+		}()
+
+		_, err = sess.CallTool(callCtx, &mcp.CallToolParams{Name: "block"})
+		if err == nil {
+			t.Errorf("CallTool(block) did not fail")
+		}
+		waitFor(cancelled, "cancelled")
+
+		cancel()
+		sess.Close()
+	}
+}
+
+func connectProxy(t *testing.T, ctx context.Context, prx *Proxy,
+	clnt *mcp.Client) *mcp.ClientSession {
+
+	prxReader, clntWriter := io.Pipe()
+	clntReader, prxWriter := io.Pipe()
+	go func() {
+		err := prx.run(ctx, slog.Default(), &mcp.IOTransport{Reader: prxReader, Writer: prxWriter})
+		if err != nil && ctx.Err() == nil {
+			t.Errorf("proxy.run() failed with %s", err)
+		}
+	}()
+
+	sess, err := clnt.Connect(ctx, &mcp.IOTransport{Reader: clntReader, Writer: clntWriter}, nil)
+	if err != nil {
+		t.Fatalf("Connect() failed with %s", err)
+	}
+	return sess
+}
+
+func newTestClient(opts *mcp.ClientOptions) *mcp.Client {
+	return mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.1.0"}, opts)
+}
+
+func samplingClient(answer string) *mcp.Client {
+	return newTestClient(&mcp.ClientOptions{
+		Capabilities: &mcp.ClientCapabilities{},
+		CreateMessageHandler: func(ctx context.Context, req *mcp.CreateMessageRequest) (
+			*mcp.CreateMessageResult, error) {
+
+			tc := req.Params.Messages[0].Content.(*mcp.TextContent)
+			return &mcp.CreateMessageResult{
+				Content: &mcp.TextContent{Text: answer + " to " + tc.Text},
+				Model:   "test-model",
+				Role:    "assistant",
+			}, nil
+		},
+	})
+}
+
+func testSampling(t *testing.T, ctx context.Context, sess *mcp.ClientSession, want string) {
+	t.Helper()
+
+	ret, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: "ask"})
+	if err != nil {
+		t.Fatalf("CallTool(ask) failed with %s", err)
+	} else if ret.IsError || len(ret.Content) != 1 {
+		t.Fatalf("CallTool(ask) got %v", ret.Content)
+	}
+	if tc, ok := ret.Content[0].(*mcp.TextContent); !ok || tc.Text != want {
+		t.Errorf("CallTool(ask) got %v want %s", ret.Content[0], want)
+	}
+}
+
+func TestProxySampling(t *testing.T) {
+	var initialized atomic.Int32
+	var sampling atomic.Bool
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
+				initialized.Add(1)
+				sampling.Store(req.Session.InitializeParams().Capabilities.Sampling != nil)
+			},
+		})
+	usvr.AddTool(&mcp.Tool{Name: "ask", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if req.Session.InitializeParams().Capabilities.Sampling == nil {
+				return nil, fmt.Errorf("client does not support sampling")
+			}
+			ret, err := req.Session.CreateMessage(ctx, &mcp.CreateMessageParams{
+				MaxTokens: 100,
+				Messages: []*mcp.SamplingMessage{
+					{Role: "user", Content: &mcp.TextContent{Text: "question"}},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.CallToolResult{Content: []mcp.Content{ret.Content}}, nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prx := NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+
+	sess := connectProxy(t, ctx, prx, samplingClient("answer"))
+	defer sess.Close()
+
+	testSampling(t, ctx, sess, "answer to question")
+	if caps := sess.InitializeResult().Capabilities; caps.Completions != nil {
+		t.Errorf("Connect() got completions capability %v want none", caps.Completions)
+	}
+	if n := initialized.Load(); n != 1 {
+		t.Errorf("upstream initialized %d times want 1", n)
+	}
+	if !sampling.Load() {
+		t.Errorf("upstream client does not support sampling")
+	}
+
+	// Without a downstream client which supports sampling, sampling is not advertised to the
+	// upstream server.
+	prx = NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+
+	sess = connectProxy(t, ctx, prx, newTestClient(nil))
+	defer sess.Close()
+
+	ret, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: "ask"})
+	if err == nil && !ret.IsError {
+		t.Errorf("CallTool(ask) got %v want an error", ret.Content)
+	}
+	if sampling.Load() {
+		t.Errorf("upstream client supports sampling")
+	}
+
+	// With more than one downstream session, sampling requests are sent to the session which
+	// called the tool.
+	lctx, lcancel := context.WithCancel(ctx)
+	defer lcancel()
+
+	prx = NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+	addr, _ := listenProxy(t, lctx, prx)
+
+	var sessions []*mcp.ClientSession
+	for _, answer := range []string{"first", "second"} {
+		sess, err := samplingClient(answer).Connect(ctx,
+			&mcp.StreamableClientTransport{Endpoint: "http://" + addr + "/mcp"}, nil)
+		if err != nil {
+			t.Fatalf("Connect() failed with %s", err)
+		}
+		defer sess.Close()
+		sessions = append(sessions, sess)
+	}
+
+	testSampling(t, ctx, sessions[1], "second to question")
+	testSampling(t, ctx, sessions[0], "first to question")
+}
+
+func TestProxyElicit(t *testing.T) {
+	var send mcp.MethodHandler
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		nil)
+	usvr.AddSendingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		send = next
+		return next
+	})
+	usvr.AddTool(&mcp.Tool{Name: "confirm", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ret, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+				Message: "continue?",
+				RequestedSchema: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"ok": map[string]any{"type": "boolean"},
+					},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			text := fmt.Sprintf("%s %v", ret.Action, ret.Content["ok"])
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}},
+				nil
+		})
+	usvr.AddTool(&mcp.Tool{Name: "login", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ret, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+				Mode:          "url",
+				Message:       "login",
+				URL:           "https://example.com/login",
+				ElicitationID: "login-1",
+			})
+			if err != nil {
+				return nil, err
+			}
+			_, err = send(ctx, "notifications/elicitation/complete",
+				&mcp.ServerRequest[*mcp.ElicitationCompleteParams]{
+					Session: req.Session,
+					Params:  &mcp.ElicitationCompleteParams{ElicitationID: "login-1"},
+				})
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: ret.Action}},
+			}, nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prx := NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+
+	completed := make(chan string, 1)
+	sess := connectProxy(t, ctx, prx, newTestClient(&mcp.ClientOptions{
+		Capabilities: &mcp.ClientCapabilities{
+			Elicitation: &mcp.ElicitationCapabilities{
+				Form: &mcp.FormElicitationCapabilities{},
+				URL:  &mcp.URLElicitationCapabilities{},
+			},
+		},
+		ElicitationHandler: func(ctx context.Context, req *mcp.ElicitRequest) (
+			*mcp.ElicitResult, error) {
+
+			if req.Params.Mode == "url" {
+				return &mcp.ElicitResult{Action: "accept"}, nil
+			}
+			return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"ok": true}},
+				nil
+		},
+		ElicitationCompleteHandler: func(ctx context.Context,
+			req *mcp.ElicitationCompleteNotificationRequest) {
+
+			completed <- req.Params.ElicitationID
+		},
+	}))
+	defer sess.Close()
+
+	for _, c := range []struct{ name, want string }{
+		{"confirm", "accept true"},
+		{"login", "accept"},
+	} {
+		ret, err := sess.CallTool(ctx, &mcp.CallToolParams{Name: c.name})
+		if err != nil {
+			t.Fatalf("CallTool(%s) failed with %s", c.name, err)
+		} else if ret.IsError || len(ret.Content) != 1 {
+			t.Fatalf("CallTool(%s) got %v", c.name, ret.Content)
+		}
+		if tc, ok := ret.Content[0].(*mcp.TextContent); !ok || tc.Text != c.want {
+			t.Errorf("CallTool(%s) got %v want %s", c.name, ret.Content[0], c.want)
+		}
+	}
+
+	select {
+	case id := <-completed:
+		if id != "login-1" {
+			t.Errorf("ElicitationComplete() got %s want login-1", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("ElicitationComplete() timed out")
+	}
+
+	// With more than one downstream session, elicitations are sent to the session which called
+	// the tool, and declined if it does not support them.
+	lctx, lcancel := context.WithCancel(ctx)
+	defer lcancel()
+
+	prx = NewProxy(Upstream{URL: svr.URL})
+	defer prx.Close()
+	addr, _ := listenProxy(t, lctx, prx)
+
+	var sessions []*mcp.ClientSession
+	for _, elicit := range []bool{false, true} {
+		opts := &mcp.ClientOptions{Capabilities: &mcp.ClientCapabilities{}}
+		if elicit {
+			opts.ElicitationHandler = func(ctx context.Context, req *mcp.ElicitRequest) (
+				*mcp.ElicitResult, error) {
+
+				return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"ok": true}},
+					nil
+			}
+		}
+		sess, err := newTestClient(opts).Connect(ctx,
+			&mcp.StreamableClientTransport{Endpoint: "http://" + addr + "/mcp"}, nil)
+		if err != nil {
+			t.Fatalf("Connect() failed with %s", err)
+		}
+		defer sess.Close()
+		sessions = append(sessions, sess)
+	}
+
+	for _, c := range []struct {
+		sess *mcp.ClientSession
+		want string
+	}{
+		{sessions[1], "accept true"},
+		{sessions[0], "decline <nil>"},
+	} {
+		ret, err := c.sess.CallTool(ctx, &mcp.CallToolParams{Name: "confirm"})
+		if err != nil {
+			t.Fatalf("CallTool(confirm) failed with %s", err)
+		} else if ret.IsError || len(ret.Content) != 1 {
+			t.Fatalf("CallTool(confirm) got %v", ret.Content)
+		}
+		if tc, ok := ret.Content[0].(*mcp.TextContent); !ok || tc.Text != c.want {
+			t.Errorf("CallTool(confirm) got %v want %s", ret.Content[0], c.want)
+		}
+	}
+}
+
+// TestNotifyElicitationComplete checks the behavior of the SDK which notifyElicitationComplete
+// relies on.
+func TestNotifyElicitationComplete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	svr := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "0.1.0"}, nil)
+	svr.AddSendingMiddleware(sendElicitationComplete)
+
+	completed := make(chan string, 1)
+	var progress atomic.Int32
+	clnt := newTestClient(&mcp.ClientOptions{
+		ElicitationCompleteHandler: func(ctx context.Context,
+			req *mcp.ElicitationCompleteNotificationRequest) {
+
+			completed <- req.Params.ElicitationID
+		},
+		ProgressNotificationHandler: func(ctx context.Context,
+			req *mcp.ProgressNotificationClientRequest) {
+
+			progress.Add(1)
+		},
+	})
+
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := svr.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatalf("Server.Connect() failed with %s", err)
+	}
+	defer ss.Close()
+	cs, err := clnt.Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatalf("Client.Connect() failed with %s", err)
+	}
+	defer cs.Close()
+
+	err = notifyElicitationComplete(ctx, ss, &mcp.ElicitationCompleteParams{ElicitationID: "e-1"})
+	if err != nil {
+		t.Fatalf("notifyElicitationComplete() failed with %s", err)
+	}
+	select {
+	case id := <-completed:
+		if id != "e-1" {
+			t.Errorf("ElicitationComplete() got %s want e-1", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("ElicitationComplete() timed out")
+	}
+
+	// Progress notifications are still sent as progress notifications.
+	err = ss.NotifyProgress(ctx, &mcp.ProgressNotificationParams{ProgressToken: "p-1"})
+	if err != nil {
+		t.Fatalf("NotifyProgress() failed with %s", err)
+	}
+	deadline := time.After(2 * time.Second)
+	for progress.Load() != 1 {
+		select {
+		case <-deadline:
+			t.Fatalf("ProgressNotification() got %d want 1", progress.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestProxyElicitDecline(t *testing.T) {
+	prx := NewProxy(Upstream{URL: "http://localhost/mcp"})
+	ret, err := prx.upstreams[0].elicit(context.Background(), &mcp.ElicitRequest{
+		Params: &mcp.ElicitParams{Message: "continue?"},
+	})
+	if err != nil {
+		t.Errorf("elicit() failed with %s", err)
+	} else if ret.Action != "decline" {
+		t.Errorf("elicit() got %s want decline", ret.Action)
+	}
+}
+
+func TestProxyRoots(t *testing.T) {
+	changed := make(chan struct{}, 4)
+	usvr := mcp.NewServer(&mcp.Implementation{Name: "test-upstream-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			RootsListChangedHandler: func(ctx context.Context, req *mcp.RootsListChangedRequest) {
+				changed <- struct{}{}
+			},
+		})
+	usvr.AddTool(&mcp.Tool{Name: "roots", InputSchema: map[string]any{"type": "object"}},
+		func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ret, err := req.Session.ListRoots(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			var uris []string
+			for _, r := range ret.Roots {
+				uris = append(uris, r.URI)
+			}
+			slices.Sort(uris)
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(uris, " ")}},
+			}, nil
+		})
+
+	svr := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return usvr }, nil))
+	defer svr.Close()
+
+	testRoots := func(sess *mcp.ClientSession, name, want string) {
+		t.Helper()
+
+		ret, err := sess.CallTool(context.Background(), &mcp.CallToolParams{Name: name})
+		if err != nil {
+			t.Fatalf("CallTool(%s) failed with %s", name, err)
+		} else if ret.IsError || len(ret.Content) != 1 {
+			t.Fatalf("CallTool(%s) got %v", name, ret.Content)
+		}
+		if tc, ok := ret.Content[0].(*mcp.TextContent); !ok || tc.Text != want {
+			t.Errorf("CallTool(%s) got %v want %s", name, ret.Content[0], want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fixedCtx, fixedCancel := context.WithCancel(ctx)
+	prx := NewProxy(Upstream{URL: svr.URL, Roots: []string{"file:///fixed"}})
+	defer prx.Close()
+
+	sess := connectProxy(t, fixedCtx, prx,
+		newTestClient(&mcp.ClientOptions{Capabilities: &mcp.ClientCapabilities{}}))
+	testRoots(sess, "roots", "file:///fixed")
+	fixedCancel()
+	sess.Close()
+
+	prx = NewProxy(Upstream{URL: svr.URL, Roots: []string{"file:///fixed"}})
+	defer prx.Close()
+
+	clnt := newTestClient(nil)
+	clnt.AddRoots(&mcp.Root{URI: "file:///a"})
+	sess = connectProxy(t, ctx, prx, clnt)
+	defer sess.Close()
+
+	testRoots(sess, "roots", "file:///a")
+
+	for len(changed) > 0 {
+		<-changed
+	}
+	clnt.AddRoots(&mcp.Root{URI: "file:///b"})
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Errorf("RootsListChanged() timed out")
+	}
+	testRoots(sess, "roots", "file:///a file:///b")
+
+	// An upstream added by Reload is provided the roots of the downstream client.
+	err := prx.Reload(ctx, Upstream{URL: svr.URL, Roots: []string{"file:///fixed"}},
+		Upstream{Name: "new", URL: svr.URL, Namespace: PrefixNamespace,
+			Roots: []string{"file:///fixed"}})
+	if err != nil {
+		t.Fatalf("Reload() failed with %s", err)
+	}
+	testRoots(sess, "new__roots", "file:///a file:///b")
+}
+
+// listenProxy starts prx listening on a free port until ctx is done, and returns the address it
+// is listening on and a channel which is closed when it stops.
+func listenProxy(t *testing.T, ctx context.Context, prx *Proxy) (string, <-chan struct{}) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() failed with %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := prx.Listen(ctx, slog.Default(), addr, true)
+		if err != nil && ctx.Err() == nil {
+			t.Errorf("proxy.Listen() failed with %s", err)
+		}
+	}()
+
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return addr, done
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("proxy never listened on %s", addr)
+		case <-done:
+			t.Fatalf("proxy stopped listening on %s", addr)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestProxyListen(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prx := NewProxy(Upstream{URL: svr.URL + "/mcp"})
+	defer prx.Close()
+	addr, done := listenProxy(t, ctx, prx)
+
+	httpClnt, err := mcpclnt.NewStreamableHttpClient("http://" + addr + "/mcp")
+	if err != nil {
+		t.Fatalf("NewStreamableHttpClient() failed with %s", err)
+	}
+	sseClnt, err := mcpclnt.NewSSEMCPClient("http://" + addr + "/sse")
+	if err != nil {
+		t.Fatalf("NewSSEMCPClient() failed with %s", err)
+	}
+
+	// Both downstream sessions are open at the same time.
+	for _, clnt := range []*mcpclnt.Client{httpClnt, sseClnt} {
+		err := clnt.Start(ctx)
+		if err != nil {
+			t.Fatalf("client.Start() failed with %s", err)
+		}
+		defer clnt.Close()
+
+		_, err = clnt.Initialize(ctx, mcpgo.InitializeRequest{
+			Params: mcpgo.InitializeParams{
+				ProtocolVersion: mcpgo.LATEST_PROTOCOL_VERSION,
+				ClientInfo:      mcpgo.Implementation{Name: "test-client", Version: "0.1.0"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("client.Initialize() failed with %s", err)
+		}
+	}
+
+	for _, clnt := range []*mcpclnt.Client{httpClnt, sseClnt} {
+		testTools(t, ctx, clnt, tsvr)
+	}
+
+	_, port, _ := net.SplitHostPort(addr)
+	for _, hdr := range []http.Header{
+		{"Host": {"rebind.example.com:" + port}},
+		{"Origin": {"http://rebind.example.com:" + port}},
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/mcp",
+			strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = hdr.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		if host := hdr.Get("Host"); host != "" {
+			req.Host = host
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do(%v) failed with %s", hdr, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Do(%v) got %d want %d", hdr, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestAllowedHost(t *testing.T) {
+	cases := []struct {
+		host     string
+		origin   string
+		loopback bool
+		want     bool
+	}{
+		{host: "127.0.0.1:8080", loopback: true, want: true},
+		{host: "localhost:8080", origin: "http://localhost:3000", loopback: true, want: true},
+		{host: "[::1]:8080", origin: "http://127.0.0.1:8080", loopback: true, want: true},
+		{host: "rebind.example.com:8080", loopback: true},
+		{host: "127.0.0.1:8080", origin: "https://example.com", loopback: true},
+		{host: "example.com:8080", want: true},
+		{host: "example.com:8080", origin: "http://example.com:8080", want: true},
+		{host: "example.com:8080", origin: "http://other.example.com:8080"},
+		{host: "example.com:8080", origin: "null"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.Host = c.host
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		got := allowedHost(r, c.loopback)
+		if got != c.want {
+			t.Errorf("allowedHost(%s, %s, %v) got %v want %v", c.host, c.origin, c.loopback, got,
+				c.want)
+		}
+	}
+}
+
+func TestProxyReload(t *testing.T) {
+	tsvr := newToolsMCPServer()
+	svr := mcpsvr.NewTestStreamableHTTPServer(tsvr)
+	defer svr.Close()
+
+	msvr := mcpsvr.NewTestStreamableHTTPServer(newMultiplyMCPServer())
+	defer msvr.Close()
+
+	a := Upstream{Name: "a", URL: svr.URL + "/mcp", Namespace: PrefixNamespace}
+	b := Upstream{Name: "b", URL: msvr.URL + "/mcp"}
+	prx := NewProxy(a)
+	testProxy(t, prx, tsvr,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan string, 16)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				select {
+				case onNotify <- notify.Method:
+				default:
+				}
+			})
+
+			deny := a
+			deny.Filter = Filter{DenyTools: []string{"add"}}
+			plain := a
+			plain.Namespace = NoNamespace
+			bad := Upstream{Name: "bad", URL: "http://127.0.0.1:1/mcp"}
+
+			cases := []struct {
+				upstreams []Upstream
+				tools     []string
+				same      []string // upstreams which keep their sessions
+				notify    bool
+				fail      bool
+			}{
+				{upstreams: []Upstream{a}, tools: []string{"a__echo", "a__add"}},
+				{upstreams: []Upstream{plain}, tools: []string{"echo", "add"}, same: []string{"a"},
+					notify: true},
+				// The echo of b is a duplicate, until a is removed.
+				{upstreams: []Upstream{plain, b}, tools: []string{"echo", "add", "multiply"},
+					same: []string{"a"}, notify: true},
+				{upstreams: []Upstream{b}, tools: []string{"multiply", "echo"},
+					same: []string{"b"}, notify: true},
+				{upstreams: []Upstream{deny, b}, tools: []string{"a__echo", "multiply", "echo"},
+					same: []string{"b"}, notify: true},
+				{upstreams: []Upstream{a, b}, tools: []string{"a__echo", "a__add", "multiply", "echo"},
+					same: []string{"a", "b"}, notify: true},
+				{upstreams: []Upstream{b, bad}, tools: []string{"multiply", "echo"}, fail: true},
+				{upstreams: []Upstream{a, b}, tools: []string{"a__echo", "a__add", "multiply", "echo"},
+					notify: true},
+			}
+
+			for i, c := range cases {
+				before := map[string]*upstream{}
+				for _, ups := range prx.upstreamList() {
+					before[ups.Name] = ups
+				}
+
+				err := prx.Reload(ctx, c.upstreams...)
+				if c.fail {
+					if err == nil {
+						t.Errorf("Reload(%d) did not fail", i)
+					}
+				} else if err != nil {
+					t.Errorf("Reload(%d) failed with %s", i, err)
+				}
+
+				if c.notify {
+					waitNotification(t, onNotify, "notifications/tools/list_changed",
+						func() bool {
+							lst, err := clnt.ListTools(ctx, mcpgo.ListToolsRequest{})
+							return err == nil && len(lst.Tools) == len(c.tools) &&
+								!slices.ContainsFunc(lst.Tools, func(tl mcpgo.Tool) bool {
+									return !slices.Contains(c.tools, tl.Name)
+								})
+						})
+				}
+				testListTools(t, ctx, clnt, c.tools)
+
+				for _, ups := range prx.upstreamList() {
+					if slices.Contains(c.same, ups.Name) && before[ups.Name] != ups {
+						t.Errorf("Reload(%d) reconnected upstream %s", i, ups.Name)
+					}
+				}
+			}
+
+			testToolCall(t, ctx, clnt, "multiply", map[string]any{"a": 3.0, "b": 4.0},
+				"product: 12")
+			testToolCall(t, ctx, clnt, "a__add", map[string]any{"a": 3.5, "b": 2.5}, "sum: 6")
+		})
+}
+
+func TestProxyReloadCapabilities(t *testing.T) {
+	psvr := mcp.NewServer(&mcp.Implementation{Name: "test-plain-server", Version: "0.1.0"}, nil)
+	plain := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return psvr }, nil))
+	defer plain.Close()
+
+	csvr := mcp.NewServer(&mcp.Implementation{Name: "test-complete-server", Version: "0.1.0"},
+		&mcp.ServerOptions{
+			CompletionHandler: func(ctx context.Context, req *mcp.CompleteRequest) (
+				*mcp.CompleteResult, error) {
+
+				return &mcp.CompleteResult{}, nil
+			},
+		})
+	complete := httptest.NewServer(mcp.NewStreamableHTTPHandler(
+		func(req *http.Request) *mcp.Server { return csvr }, nil))
+	defer complete.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	a := Upstream{Name: "a", URL: plain.URL}
+	prx := NewProxy(a)
+	defer prx.Close()
+	addr, _ := listenProxy(t, ctx, prx)
+
+	connect := func() *mcp.ClientSession {
+		sess, err := newTestClient(nil).Connect(ctx,
+			&mcp.StreamableClientTransport{Endpoint: "http://" + addr + "/mcp"}, nil)
+		if err != nil {
+			t.Fatalf("Connect() failed with %s", err)
+		}
+		return sess
+	}
+
+	sess := connect()
+	defer sess.Close()
+	if caps := sess.InitializeResult().Capabilities; caps.Completions != nil {
+		t.Errorf("Connect() got completions capability %v want none", caps.Completions)
+	}
+
+	err := prx.Reload(ctx, a, Upstream{Name: "b", URL: complete.URL})
+	if err != nil {
+		t.Fatalf("Reload() failed with %s", err)
+	}
+
+	// Downstream clients which initialize after the reload see the capabilities of the new
+	// upstream.
+	sess = connect()
+	defer sess.Close()
+	if caps := sess.InitializeResult().Capabilities; caps.Completions == nil {
+		t.Errorf("Connect() got no completions capability after Reload()")
+	}
+}
+
+func TestProxyRestart(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable() failed with %s", err)
+	}
+
+	prx := NewProxy(Upstream{
+		Command: exe,
+		Env:     []string{"GMCPT_TEST_SERVER=" + filepath.Join(t.TempDir(), "starts")},
+	})
+	testProxy(t, prx, nil,
+		func(t *testing.T, ctx context.Context, clnt *mcpclnt.Client, tsvr *mcpsvr.MCPServer) {
+			onNotify := make(chan string, 16)
+			clnt.OnNotification(func(notify mcpgo.JSONRPCNotification) {
+				select {
+				case onNotify <- notify.Method:
+				default:
+				}
+			})
+
+			testListTools(t, ctx, clnt, []string{"exit", "start1"})
+			_, err := clnt.CallTool(ctx, mcpgo.CallToolRequest{
+				Params: mcpgo.CallToolParams{Name: "exit"},
+			})
+			if err == nil {
+				t.Error("CallTool(exit) did not fail")
+			}
+
+			waitNotification(t, onNotify, "notifications/tools/list_changed",
+				hasTool(ctx, clnt, "start2"))
+			testListTools(t, ctx, clnt, []string{"exit", "start2"})
+		})
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Reload changes the upstreams of a running proxy without closing the downstream sessions.
+// Upstreams which connect to the same server in the same way keep their sessions; changes to
+// their namespace, separator, renames, filter, tee logging, and roots are applied in place.
+// Removed upstreams, and upstreams which connect differently, are closed and their tools, prompts,
+// and resources removed, and new upstreams are connected and their tools, prompts, and resources
+// added, so downstream clients are sent list changed notifications. New upstreams which fail to
+// start are not added; the errors are returned.
+//
+// The capabilities of the proxy are sent to each downstream client when it initializes, so
+// downstream sessions which are already open can not use resource subscriptions or completions
+// of new upstreams when no upstream had them before.
+func (prx *Proxy) Reload(ctx context.Context, upstreams ...Upstream) error {
+	prx.reloadMu.Lock()
+	defer prx.reloadMu.Unlock()
+
+	prx.mu.Lock()
+	running := prx.svr != nil
+	prx.mu.Unlock()
+	if !running {
+		return errors.New("proxy is not running")
+	}
+
+	before := prx.upstreamList()
+	current := map[string]*upstream{}
+	for _, ups := range before {
+		current[ups.Name] = ups
+	}
+	subscribe, completions := upstreamCapabilities(before)
+
+	var keep, add []*upstream
+	for _, u := range nameUpstreams(upstreams) {
+		if ups, ok := current[u.Name]; ok && sameConnection(ups.Upstream, u) {
+			keep = append(keep, ups)
+			delete(current, u.Name)
+
+			u.TLS = ups.TLS
+			if !reflect.DeepEqual(ups.Upstream, u) {
+				slog.Info("change upstream", "upstream", ups.Name)
+				ups.change(ctx, u)
+			}
+			continue
+		}
+
+		add = append(add, prx.newUpstream(u))
+	}
+
+	for _, ups := range current {
+		slog.Info("remove upstream", "upstream", ups.Name)
+		ups.remove()
+	}
+
+	var errs []error
+	for _, ups := range add {
+		slog.Info("add upstream", "upstream", ups.Name)
+
+		err := ups.withSession(ctx, ups.initializeResult)
+		if err == nil {
+			err = ups.start(ctx)
+		}
+		if err != nil {
+			slog.Error("add upstream", "upstream", ups.Name, "error", err)
+			errs = append(errs, fmt.Errorf("upstream %s: %w", ups.Name, err))
+			ups.remove()
+			continue
+		}
+		keep = append(keep, ups)
+	}
+
+	prx.mu.Lock()
+	prx.upstreams = keep
+	prx.mu.Unlock()
+
+	if len(prx.sessions(nil)) > 0 {
+		newSubscribe, newCompletions := upstreamCapabilities(keep)
+		if newSubscribe && !subscribe {
+			slog.Warn("downstream sessions must reconnect to subscribe to resources")
+		}
+		if newCompletions && !completions {
+			slog.Warn("downstream sessions must reconnect to use completions")
+		}
+	}
+
+	for _, ups := range add {
+		if !ups.closed.Load() {
+			// The roots of the downstream client may have changed while the upstream started.
+			ups.setRoots()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// change changes the settings of the upstream which do not affect its connection, and updates
+// its tools, prompts, resources, resource templates, roots, and logging level to match.
+func (ups *upstream) change(ctx context.Context, u Upstream) {
+	prx := ups.prx
+	prx.mu.Lock()
+	ups.mu.Lock()
+	ups.Namespace = u.Namespace
+	ups.Separator = u.Separator
+	ups.Rename = u.Rename
+	ups.Filter = u.Filter
+	ups.TeeLogging = u.TeeLogging
+	ups.Roots = u.Roots
+	ups.mu.Unlock()
+
+	removed := ups.registerTools()
+	removed = ups.registerPrompts() || removed
+	removed = ups.registerResources() || removed
+	removed = ups.registerResourceTemplates() || removed
+	if removed {
+		prx.registerOthers(ups)
+	}
+	prx.mu.Unlock()
+
+	ups.setRoots()
+	err := ups.withSession(ctx, ups.setLoggingLevel)
+	if err != nil {
+		slog.Error("set logging level", "upstream", ups.Name, "error", err)
+	}
+}
+
+// remove closes the upstream and removes its tools, prompts, resources, and resource templates.
+func (ups *upstream) remove() {
+	ups.closed.Store(true)
+
+	prx := ups.prx
+	prx.mu.Lock()
+	if names := removeOwned(prx.tools, maps.Keys(ups.toolNames)); len(names) > 0 {
+		prx.svr.RemoveTools(names...)
+	}
+	if names := removeOwned(prx.prompts, maps.Keys(ups.promptNames)); len(names) > 0 {
+		prx.svr.RemovePrompts(names...)
+	}
+	if uris := removeOwned(prx.resources, maps.Keys(ups.resourceURIs)); len(uris) > 0 {
+		prx.svr.RemoveResources(uris...)
+	}
+	if uris := removeOwned(prx.templates, maps.Keys(ups.templateURIs)); len(uris) > 0 {
+		prx.svr.RemoveResourceTemplates(uris...)
+	}
+	ups.toolNames = nil
+	ups.promptNames = nil
+	ups.resourceURIs = nil
+	ups.templateURIs = nil
+	prx.registerOthers(ups)
+	prx.mu.Unlock()
+
+	ups.sm.Shutdown()
+}
+
+func removeOwned(owners map[string]*upstream, names iter.Seq[string]) []string {
+	var removed []string
+	for name := range names {
+		delete(owners, name)
+		removed = append(removed, name)
+	}
+	slices.Sort(removed)
+	return removed
+}
+
+// sameConnection returns true if the upstreams connect to the same server in the same way: they
+// differ at most in the settings which change applies in place.
+func sameConnection(u1, u2 Upstream) bool {
+	if !sameTLS(u1.TLS, u2.TLS) {
+		return false
+	}
+	for _, u := range []*Upstream{&u1, &u2} {
+		u.TLS = nil
+		u.Namespace = NoNamespace
+		u.Separator = ""
+		u.Rename = nil
+		u.Filter = Filter{}
+		u.TeeLogging = false
+		u.Roots = nil
+	}
+	return reflect.DeepEqual(u1, u2)
+}
+
+func sameTLS(c1, c2 *tls.Config) bool {
+	if c1 == nil || c2 == nil {
+		return c1 == c2
+	}
+	if (c1.RootCAs == nil) != (c2.RootCAs == nil) ||
+		(c1.RootCAs != nil && !c1.RootCAs.Equal(c2.RootCAs)) {
+
+		return false
+	}
+	return reflect.DeepEqual(c1.Certificates, c2.Certificates) &&
+		c1.ServerName == c2.ServerName && c1.MinVersion == c2.MinVersion
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func fixedRoots(uris []string) []*mcp.Root {
+	var roots []*mcp.Root
+	for _, uri := range uris {
+		roots = append(roots, &mcp.Root{URI: uri})
+	}
+	return roots
+}
+
+// updateRoots mirrors the roots of the downstream session to the upstream servers. Each upstream
+// session is shared by all of the downstream sessions, so if there is more than one downstream
+// session, the fixed roots are used instead.
+func (prx *Proxy) updateRoots(ctx context.Context, sessions []*mcp.ServerSession) {
+	var roots []*mcp.Root
+	if len(sessions) == 1 && clientCapabilities(sessions[0]).RootsV2 != nil {
+		// A session does not finish closing while a request to its client is outstanding, and
+		// the client may be going away.
+		ctx, cancel := context.WithTimeout(ctx, listRootsTimeout)
+		defer cancel()
+
+		ret, err := sessions[0].ListRoots(ctx, nil)
+		if err != nil {
+			slog.Error("list roots", "error", err)
+			return
+		}
+		roots = ret.Roots
+	}
+
+	prx.mu.Lock()
+	prx.roots = roots
+	prx.mu.Unlock()
+
+	for _, ups := range prx.upstreamList() {
+		ups.setRoots()
+	}
+}
+
+const listRootsTimeout = 10 * time.Second
+
+func (prx *Proxy) rootsListChanged(ctx context.Context, req *mcp.RootsListChangedRequest) {
+	prx.updateRoots(ctx, prx.sessions(nil))
+}
+
+// setRoots sets the roots provided to the upstream server to the roots of the downstream client;
+// if there are none, the fixed roots are used instead.
+func (ups *upstream) setRoots() {
+	prx := ups.prx
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	roots := prx.roots
+	if len(roots) == 0 {
+		roots = fixedRoots(ups.Roots)
+	}
+
+	uris := map[string]struct{}{}
+	for _, r := range roots {
+		uris[r.URI] = struct{}{}
+	}
+
+	if len(roots) == len(ups.roots) && !slices.ContainsFunc(ups.roots, func(r *mcp.Root) bool {
+		_, ok := uris[r.URI]
+		return !ok
+	}) {
+		// The roots are unchanged.
+		return
+	}
+
+	var remove []string
+	for _, r := range ups.roots {
+		if _, ok := uris[r.URI]; !ok {
+			remove = append(remove, r.URI)
+		}
+	}
+	if ups.clnt != nil {
+		// Otherwise, the client is created with the roots when it is first used.
+		if len(remove) > 0 {
+			ups.clnt.RemoveRoots(remove...)
+		}
+		ups.clnt.AddRoots(roots...)
+	}
+
+	ups.roots = roots
+}
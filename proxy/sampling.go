@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func (ups *upstream) createMessage(ctx context.Context, req *mcp.CreateMessageRequest) (
+	*mcp.CreateMessageResult, error) {
+
+	ss, err := ups.requestSession(func(caps *mcp.ClientCapabilities) bool {
+		return caps.Sampling != nil
+	})
+	if err != nil {
+		slog.Error("create message", "upstream", ups.Name, "error", err)
+		return nil, err
+	}
+
+	ret, err := ss.CreateMessage(ctx, req.Params)
+	if err != nil {
+		slog.Error("create message", "upstream", ups.Name, "error", err)
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"bytes"
+	"log/slog"
+)
+
+// stderrLogger writes each line of standard error from an upstream command to the log.
+type stderrLogger struct {
+	upstream string
+	buf      []byte
+}
+
+func (sl *stderrLogger) Write(p []byte) (int, error) {
+	sl.buf = append(sl.buf, p...)
+	for {
+		n := bytes.IndexByte(sl.buf, '\n')
+		if n < 0 {
+			break
+		}
+
+		line := bytes.TrimRight(sl.buf[:n], "\r")
+		if len(line) > 0 {
+			slog.Info("stderr", "upstream", sl.upstream, "line", string(line))
+		}
+		sl.buf = sl.buf[n+1:]
+	}
+	return len(p), nil
+}
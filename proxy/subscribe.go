@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/yosida95/uritemplate/v3"
+)
+
+func (prx *Proxy) resourceOwner(uri string) *upstream {
+	prx.mu.Lock()
+	defer prx.mu.Unlock()
+
+	if ups, ok := prx.resources[uri]; ok {
+		return ups
+	}
+	for tmpl, ups := range prx.templates {
+		ut, err := uritemplate.New(tmpl)
+		if err == nil && ut.Regexp().MatchString(uri) {
+			return ups
+		}
+	}
+	return nil
+}
+
+func (prx *Proxy) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	ups := prx.resourceOwner(uri)
+	if ups == nil {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	if !ups.filter().allowResource(ups.upstreamURI(uri), uri) {
+		slog.Warn("subscribe filtered resource", "upstream", ups.Name, "uri", uri)
+		return mcp.ResourceNotFoundError(uri)
+	}
+
+	prx.subMu.Lock()
+	sessions, ok := prx.subscriptions[uri]
+	if !ok {
+		sessions = map[*mcp.ServerSession]struct{}{}
+		prx.subscriptions[uri] = sessions
+	}
+	sessions[req.Session] = struct{}{}
+	first := len(sessions) == 1
+	prx.subMu.Unlock()
+
+	if !first {
+		return nil
+	}
+
+	err := ups.withSession(ctx,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			return sess.Subscribe(ctx, &mcp.SubscribeParams{URI: ups.upstreamURI(uri)})
+		})
+	if err != nil {
+		slog.Error("subscribe", "upstream", ups.Name, "uri", uri, "error", err)
+		prx.removeSubscription(uri, req.Session)
+		return err
+	}
+	return nil
+}
+
+func (prx *Proxy) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	if prx.removeSubscription(req.Params.URI, req.Session) {
+		prx.unsubscribeUpstream(ctx, req.Params.URI)
+	}
+	return nil
+}
+
+// removeSubscription returns true if ss was the last session subscribed to uri.
+func (prx *Proxy) removeSubscription(uri string, ss *mcp.ServerSession) bool {
+	prx.subMu.Lock()
+	defer prx.subMu.Unlock()
+
+	sessions, ok := prx.subscriptions[uri]
+	if !ok {
+		return false
+	}
+	if _, ok := sessions[ss]; !ok {
+		return false
+	}
+	delete(sessions, ss)
+	if len(sessions) > 0 {
+		return false
+	}
+	delete(prx.subscriptions, uri)
+	return true
+}
+
+func (prx *Proxy) unsubscribeUpstream(ctx context.Context, uri string) {
+	ups := prx.resourceOwner(uri)
+	if ups == nil {
+		return
+	}
+
+	err := ups.withSession(ctx,
+		func(ctx context.Context, sess *mcp.ClientSession) error {
+			return sess.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: ups.upstreamURI(uri)})
+		})
+	if err != nil {
+		slog.Error("unsubscribe", "upstream", ups.Name, "uri", uri, "error", err)
+	}
+}
+
+func (prx *Proxy) unsubscribeSession(ss *mcp.ServerSession) {
+	prx.subMu.Lock()
+	var uris []string
+	for uri := range prx.subscriptions {
+		uris = append(uris, uri)
+	}
+	prx.subMu.Unlock()
+
+	if prx.closed.Load() {
+		return
+	}
+	for _, uri := range uris {
+		if prx.removeSubscription(uri, ss) {
+			prx.unsubscribeUpstream(context.Background(), uri)
+		}
+	}
+}
+
+func (ups *upstream) resourceUpdated(ctx context.Context,
+	req *mcp.ResourceUpdatedNotificationRequest) {
+
+	prx := ups.prx
+	prx.mu.Lock()
+	svr := prx.svr
+	prx.mu.Unlock()
+
+	if svr == nil || prx.closed.Load() {
+		return
+	}
+
+	err := svr.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{
+		URI: ups.downstreamURI(req.Params.URI),
+	})
+	if err != nil {
+		slog.Error("resource updated", "upstream", ups.Name, "uri", req.Params.URI, "error", err)
+	}
+}
@@ -2,28 +2,175 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/leftmike/gmcpt/config"
 	"github.com/leftmike/gmcpt/proxy"
 )
 
 func proxyCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
-	var logProto, url, apiKey, header string
+	var logProto, listen string
+	var urls []string
+	var listenSSE bool
+	var flg config.Server
+	renames := map[string]map[string]string{} // server name -> name -> new name
 
 	fs.StringVar(&logProto, "logproto", "", "protocol log file path")
-	fs.StringVar(&url, "url", "", "remote MCP server URL")
-	fs.StringVar(&apiKey, "api-key", "", "API key for remote server")
-	fs.StringVar(&header, "header", "", "header for API key")
+	fs.StringVar(&listen, "listen", "",
+		"serve over Streamable HTTP at /mcp on this address, such as :8080, instead of stdio; "+
+			"the host defaults to 127.0.0.1")
+	fs.BoolVar(&listenSSE, "listen-sse", false, "with -listen, also serve over SSE at /sse")
+	fs.Func("url", "remote MCP server [name=]URL (may be repeated); the remote server flags "+
+		"apply to every -url, so use a configuration file for servers which need different ones",
+		func(s string) error {
+			urls = append(urls, s)
+			return nil
+		})
+	serverFlags(fs, &flg)
+	fs.StringVar(&flg.Dir, "dir", "", "working directory for local server command")
+	fs.Func("env", "environment variable for local server command: KEY=VALUE (may be repeated)",
+		func(s string) error {
+			key, val, ok := strings.Cut(s, "=")
+			if !ok || key == "" {
+				return errors.New("must be KEY=VALUE")
+			}
+			if flg.Env == nil {
+				flg.Env = map[string]string{}
+			}
+			flg.Env[key] = val
+			return nil
+		})
+	fs.StringVar(&flg.Namespace, "namespace", "none",
+		"namespace tools, prompts, and resources by server name: none, prefix, or suffix")
+	fs.StringVar(&flg.Separator, "separator", "__", "separator between server name and tool name")
+	fs.Func("rename",
+		"rename a tool or prompt of the server, or of every server: [server:]name=newname "+
+			"(may be repeated)",
+		func(s string) error {
+			name, newName, ok := strings.Cut(s, "=")
+			srvName, n, scoped := strings.Cut(name, ":")
+			if scoped {
+				name = n
+			} else {
+				srvName = ""
+			}
+			if !ok || name == "" || newName == "" || (scoped && srvName == "") {
+				return errors.New("must be [server:]name=newname")
+			}
+			if renames[srvName] == nil {
+				renames[srvName] = map[string]string{}
+			}
+			renames[srvName][name] = newName
+			return nil
+		})
+	globsVar(fs, &flg.AllowTools, "allow-tools", "tools to allow")
+	globsVar(fs, &flg.DenyTools, "deny-tools", "tools to deny")
+	globsVar(fs, &flg.AllowPrompts, "allow-prompts", "prompts to allow")
+	globsVar(fs, &flg.DenyPrompts, "deny-prompts", "prompts to deny")
+	globsVar(fs, &flg.AllowResources, "allow-resources", "resource URIs to allow")
+	globsVar(fs, &flg.DenyResources, "deny-resources", "resource URIs to deny")
+	fs.BoolVar(&flg.HideDestructive, "hide-destructive", false,
+		"hide tools which may be destructive: not annotated as read only or not destructive")
+	fs.BoolVar(&flg.ReadOnly, "read-only", false, "only allow tools annotated as read only")
+	fs.BoolVar(&flg.TeeLogging, "tee-logging", false,
+		"also write log messages from upstream servers to the log")
+	fs.Func("root", "root directory or URI to use when the client provides none (may be repeated)",
+		func(s string) error {
+			flg.Roots = append(flg.Roots, s)
+			return nil
+		})
 
-	args, l := parse()
-	if len(args) != 0 {
-		fatal("no arguments are allowed")
-	} else if url == "" {
-		fatal("url is required")
+	cmd, l := parse()
+	var names []string
+	if len(cmd) == 1 && configuredServers(strings.Split(cmd[0], ",")) {
+		names = strings.Split(cmd[0], ",")
+		cmd = nil
+	}
+	// Without server names, a url, or a command, all of the configured servers are proxied.
+	all := len(names) == 0 && len(urls) == 0 && len(cmd) == 0
+	if listen != "" && logProto != "" {
+		fatal("-logproto is not supported with -listen")
+	} else if listen == "" && listenSSE {
+		fatal("-listen-sse requires -listen")
+	}
+
+	proxyUpstreams := func(cfg *config.Config) ([]proxy.Upstream, error) {
+		var upstreams []proxy.Upstream
+		renamed := map[string]bool{}
+		addUpstream := func(name string, srv config.Server) error {
+			applyFlags(fs, &srv, &flg)
+			for _, srvName := range []string{"", name} {
+				if rn, ok := renames[srvName]; ok {
+					srv.Rename = mergeMaps(srv.Rename, rn)
+					renamed[srvName] = true
+				}
+			}
+			ups, err := srv.Upstream(name)
+			if err != nil {
+				return err
+			}
+			upstreams = append(upstreams, ups)
+			return nil
+		}
+
+		srvNames := names
+		if all {
+			srvNames = slices.Sorted(maps.Keys(cfg.Servers))
+		}
+		for _, name := range srvNames {
+			srv, ok := cfg.Servers[name]
+			if !ok {
+				return nil, fmt.Errorf("server not found in configuration: %s", name)
+			}
+			err := addUpstream(name, *srv)
+			if err != nil {
+				return nil, fmt.Errorf("server %s: %s", name, err)
+			}
+		}
+		for _, url := range urls {
+			var name string
+			if n, u, ok := strings.Cut(url, "="); ok && !strings.ContainsAny(n, ":/?") {
+				name = n
+				url = u
+			}
+			err := addUpstream(name, config.Server{URL: url})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(cmd) > 0 {
+			err := addUpstream("", config.Server{Command: cmd[0], Args: cmd[1:]})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for srvName := range renames {
+			if srvName != "" && !renamed[srvName] {
+				return nil, fmt.Errorf("-rename: no server named %s", srvName)
+			}
+		}
+		return upstreams, nil
+	}
+
+	cfg := &config.Config{}
+	if all || len(names) > 0 {
+		cfg = loadConfig()
+	}
+	upstreams, err := proxyUpstreams(cfg)
+	if err != nil {
+		fatal(err.Error())
+	} else if len(upstreams) == 0 {
+		fatal("server names, url, or command is required")
 	}
 
 	slog.Info("starting", "cmd", os.Args[0]+os.Args[1], "args", strings.Join(os.Args[2:], " "),
@@ -32,7 +179,25 @@ func proxyCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	err := proxy.NewProxy(url, apiKey, header, false).Run(ctx, l, logProto)
+	prx := proxy.NewProxy(upstreams...)
+	if all || len(names) > 0 {
+		// The configured servers are reloaded when the configuration changes.
+		go watchConfig(ctx, cfg, func(cfg *config.Config) {
+			upstreams, err := proxyUpstreams(cfg)
+			if err == nil {
+				err = prx.Reload(ctx, upstreams...)
+			}
+			if err != nil {
+				slog.Error("reload", "error", err)
+			}
+		})
+	}
+
+	if listen != "" {
+		err = prx.Listen(ctx, l, listen, listenSSE)
+	} else {
+		err = prx.Run(ctx, l, logProto)
+	}
 	if err != nil && ctx.Err() == nil {
 		fatal(err.Error())
 	}
@@ -40,3 +205,65 @@ func proxyCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
 	slog.Info("exiting", "cmd", os.Args[0]+os.Args[1], "args", strings.Join(os.Args[2:], " "),
 		"pid", os.Getpid())
 }
+
+func globsVar(fs *flag.FlagSet, globs *[]string, name, usage string) {
+	fs.Func(name, usage+": comma separated globs (may be repeated)", func(s string) error {
+		for glob := range strings.SplitSeq(s, ",") {
+			if glob = strings.TrimSpace(glob); glob != "" {
+				*globs = append(*globs, glob)
+			}
+		}
+		return nil
+	})
+}
+
+// watchConfig calls reload with the new configuration when SIGHUP is received or when one of the
+// configuration files changes, until ctx is done.
+func watchConfig(ctx context.Context, cfg *config.Config, reload func(cfg *config.Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	files := cfg.Files()
+	stats := statFiles(files)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("reload", "reason", "SIGHUP")
+		case <-ticker.C:
+			if maps.Equal(stats, statFiles(files)) {
+				continue
+			}
+			slog.Info("reload", "reason", "configuration changed")
+		}
+
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			slog.Error("reload", "error", err)
+		} else {
+			files = cfg.Files()
+			reload(cfg)
+		}
+		stats = statFiles(files)
+	}
+}
+
+type fileStat struct {
+	modTime int64
+	size    int64
+}
+
+func statFiles(files []string) map[string]fileStat {
+	stats := map[string]fileStat{}
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil {
+			stats[file] = fileStat{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/leftmike/gmcpt/client"
+	"github.com/leftmike/gmcpt/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func readCmd(fs *flag.FlagSet, parse func() ([]string, *slog.Logger)) {
+	var server, output, template string
+	var json bool
+	var flg config.Server
+
+	fs.StringVar(&server, "server", "", "name of server in configuration file")
+	fs.StringVar(&flg.URL, "url", "", "remote MCP server URL")
+	serverFlags(fs, &flg)
+	fs.StringVar(&output, "o", "", "output file, or directory for multiple contents")
+	fs.StringVar(&template, "template", "", "resource template to expand with key=value arguments")
+	fs.BoolVar(&json, "json", false, "output as JSON")
+
+	args, _ := parse()
+	args, cmd := splitCommand(args)
+	rmt, lcl := resolveServer(fs, server, &flg, cmd)
+
+	var uri string
+	if template != "" {
+		var err error
+		uri, err = client.ExpandTemplate(template, args)
+		if err != nil {
+			fatal(err.Error())
+		}
+	} else if len(args) != 1 {
+		fatal("exactly one resource uri must be specified")
+	} else {
+		uri = args[0]
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var ret *mcp.ReadResourceResult
+	var err error
+	if lcl != nil {
+		ret, err = client.ReadLocal(ctx, *lcl, uri)
+	} else {
+		ret, err = client.ReadRemote(ctx, *rmt, uri)
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	if json {
+		printJSON(ret)
+	} else if output != "" {
+		writeResourceContents(ret.Contents, output)
+	} else {
+		printResourceContents(ret.Contents)
+	}
+}
+
+func isTextMIMEType(mimeType string) bool {
+	mt, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || mt == "application/json" ||
+		mt == "application/xml" || mt == "application/javascript" || mt == "application/yaml" ||
+		strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+func printResourceContents(contents []*mcp.ResourceContents) {
+	for _, rc := range contents {
+		if rc.Blob == nil {
+			fmt.Print(rc.Text)
+			if !strings.HasSuffix(rc.Text, "\n") {
+				fmt.Println()
+			}
+		} else if isTextMIMEType(rc.MIMEType) {
+			os.Stdout.Write(rc.Blob)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s %s: %s %s, %d bytes: use -o to save\n", os.Args[0],
+				os.Args[1], rc.URI, rc.MIMEType, len(rc.Blob))
+		}
+	}
+}
+
+// contentsFilename returns a file name for the ith contents which is not in used; the index is
+// appended to the base name of the URI if another contents already has the same base name.
+func contentsFilename(rc *mcp.ResourceContents, i int, used map[string]bool) string {
+	name := path.Base(rc.URI)
+	if name == "." || name == ".." || name == "/" || strings.ContainsAny(name, ":?#\\") {
+		name = fmt.Sprintf("contents-%d", i)
+		if exts, err := mime.ExtensionsByType(rc.MIMEType); err == nil && len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := i; used[name]; n += 1 {
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	used[name] = true
+	return name
+}
+
+func writeResourceContents(contents []*mcp.ResourceContents, output string) {
+	if len(contents) > 1 {
+		err := os.MkdirAll(output, 0755)
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+
+	used := map[string]bool{}
+	for i, rc := range contents {
+		fn := output
+		if len(contents) > 1 {
+			fn = filepath.Join(output, contentsFilename(rc, i, used))
+		}
+
+		data := rc.Blob
+		if data == nil {
+			data = []byte(rc.Text)
+		}
+		err := os.WriteFile(fn, data, 0644)
+		if err != nil {
+			fatal(err.Error())
+		}
+		fmt.Printf("%s: %s %d bytes\n", fn, rc.MIMEType, len(data))
+	}
+}